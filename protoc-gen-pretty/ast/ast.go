@@ -0,0 +1,295 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+// Package ast represents .proto files as they are written: every declaration
+// in the order of the source, with its position, the comments around it as
+// they are written, and the blank lines that separate it from the one before.
+//
+// Parse builds the tree of a file, and the Fmt method of File prints it in the
+// style of the formatter.
+package ast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Position is a place in a source file. Lines and columns start at 1, and
+// columns count bytes.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+func (this Position) String() string {
+	return fmt.Sprintf("%d:%d", this.Line, this.Column)
+}
+
+// Comment is a single comment, with its markers: "// text" or "/* text */".
+type Comment struct {
+	Pos  Position
+	Text string
+}
+
+// Block returns whether the comment is a /* */ comment.
+func (this *Comment) Block() bool {
+	return strings.HasPrefix(this.Text, "/*")
+}
+
+// CommentGroup is a run of comments without blank lines or code between them.
+type CommentGroup struct {
+	List []*Comment
+}
+
+// Text returns the text of the comments without their markers, one line per
+// line of the comments.
+func (this *CommentGroup) Text() string {
+	var lines []string
+	for _, c := range this.List {
+		text := c.Text
+		if c.Block() {
+			text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+		} else {
+			text = strings.TrimPrefix(text, "//")
+		}
+		for _, line := range strings.Split(text, "\n") {
+			lines = append(lines, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "*")))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Node is any element of the tree.
+type Node interface {
+	Start() Position
+	End() Position
+}
+
+// Decl is a declaration: a statement or a block in a file, message, enum,
+// service, oneof, extend or rpc. Base returns the part all declarations share.
+type Decl interface {
+	Node
+	Base() *Element
+}
+
+// Element holds what every declaration has in common.
+type Element struct {
+	Pos    Position // The first character
+	EndPos Position // The character after the last one
+
+	// Comment groups above the leading comments, separated from them and from
+	// each other by blank lines.
+	Detached []*CommentGroup
+	// The comments directly above the element.
+	Leading *CommentGroup
+	// A comment after the element on the line it ends on.
+	Trailing *CommentGroup
+	// Comments between the tokens of the element that are not in a block.
+	Inner []*CommentGroup
+	// Whether a blank line separates the element, or its leading comments,
+	// from what comes before it.
+	BlankBefore bool
+
+	first, last int // Indices of the first and last token
+}
+
+func (this *Element) Start() Position { return this.Pos }
+func (this *Element) End() Position   { return this.EndPos }
+func (this *Element) Base() *Element  { return this }
+
+// Block is the body of a message, enum, service, oneof, extend, group or rpc.
+type Block struct {
+	Open  Position // The opening brace
+	Close Position // The closing brace
+	Decls []Decl
+
+	// A comment after the opening brace on its line.
+	OpenComment *CommentGroup
+	// Comments after the last declaration.
+	EndComments []*CommentGroup
+	// Whether a blank line separates the end comments from what comes before.
+	BlankBeforeEnd bool
+
+	open, close int // Indices of the braces
+}
+
+// Value is the value of an option as it is written, such as 1.5, -2, FOO,
+// "text" or an aggregate { a: 1 }.
+type Value struct {
+	Pos  Position
+	Kind ValueKind
+	Text string
+}
+
+// ValueKind tells values apart.
+type ValueKind int
+
+const (
+	IdentifierValue ValueKind = iota
+	IntValue
+	FloatValue
+	StringValue
+	AggregateValue
+)
+
+// File is a .proto file.
+type File struct {
+	Name  string
+	Decls []Decl
+
+	// Comments after the last declaration.
+	EndComments []*CommentGroup
+	// All the comments of the file, in order.
+	Comments []*CommentGroup
+}
+
+// Syntax is a syntax = "proto2"; statement.
+type Syntax struct {
+	Element
+	Value string // Without the quotes
+}
+
+// Package is a package statement.
+type Package struct {
+	Element
+	Name string
+}
+
+// Import is an import statement.
+type Import struct {
+	Element
+	Modifier string // "public", "weak" or empty
+	Path     string // Without the quotes
+}
+
+// Option is an option statement, or an option between the brackets of a
+// field, enum value or extension range.
+type Option struct {
+	Element
+	Name  string // As written, such as java_package or (my.opt).field
+	Value *Value
+}
+
+// Message is a message declaration.
+type Message struct {
+	Element
+	Block
+	Name string
+}
+
+// Field is a field of a message, oneof or extend, including map fields.
+type Field struct {
+	Element
+	Label   string // "optional", "required", "repeated" or empty
+	Type    string // As written, such as int32, .pkg.Msg or map<string, int32>
+	Name    string
+	Number  string // As written
+	Options []*Option
+}
+
+// Group is a group field with its message.
+type Group struct {
+	Element
+	Block
+	Label   string
+	Name    string
+	Number  string
+	Options []*Option
+}
+
+// Oneof is a oneof declaration.
+type Oneof struct {
+	Element
+	Block
+	Name string
+}
+
+// Enum is an enum declaration.
+type Enum struct {
+	Element
+	Block
+	Name string
+}
+
+// EnumValue is a value of an enum.
+type EnumValue struct {
+	Element
+	Name    string
+	Number  string // As written, with its sign
+	Options []*Option
+}
+
+// Service is a service declaration.
+type Service struct {
+	Element
+	Block
+	Name string
+}
+
+// RPC is a method of a service. Without a body it ends in a semicolon.
+type RPC struct {
+	Element
+	Block
+	Name         string
+	InputStream  bool
+	Input        string
+	OutputStream bool
+	Output       string
+	HasBody      bool
+}
+
+// Extend is an extend block.
+type Extend struct {
+	Element
+	Block
+	Extendee string
+}
+
+// Range is a range of field or enum numbers, as written. End is empty for a
+// single number, and may be "max".
+type Range struct {
+	Start string
+	End   string
+}
+
+// Reserved is a reserved statement, of either numbers or names.
+type Reserved struct {
+	Element
+	Ranges []*Range
+	Names  []string // Without the quotes
+}
+
+// Extensions is an extensions statement.
+type Extensions struct {
+	Element
+	Ranges  []*Range
+	Options []*Option
+}
+
+// Empty is a lone semicolon.
+type Empty struct {
+	Element
+}
@@ -0,0 +1,178 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package ast
+
+// Attaches the comments of the file to the elements of the tree.
+//
+// A comment after code on the same line trails the element or block that
+// code ends, and stands alone. Other comments are grouped while they are on
+// consecutive lines. A group directly above a declaration leads it; groups
+// separated from it by blank lines are detached. Groups at the end of a block
+// or the file are its end comments, and any others are inner comments of the
+// element they are in.
+func attachComments(file *File, p *parser, comments []*Comment) {
+	endsAt := make(map[int]*Element)
+	startsAt := make(map[int]*Element)
+	for _, e := range p.elements {
+		if _, ok := endsAt[e.last]; !ok {
+			endsAt[e.last] = e
+		}
+		// Elements are finished inside out, so the outermost one wins
+		startsAt[e.first] = e
+	}
+	opens := make(map[int]*Block)
+	closes := make(map[int]*Block)
+	for _, b := range p.blocks {
+		opens[b.open] = b
+		closes[b.close] = b
+	}
+
+	for _, g := range groupComments(p.tokens, comments) {
+		file.Comments = append(file.Comments, g)
+		first := g.List[0]
+		last := g.List[len(g.List)-1]
+		prev := tokenBefore(p.tokens, first.Pos.Offset)
+		next := prev + 1
+
+		if prev >= 0 && p.tokens[prev].endPos.Line == first.Pos.Line {
+			if e, ok := endsAt[prev]; ok && e.Trailing == nil {
+				e.Trailing = g
+			} else if b, ok := opens[prev]; ok && b.OpenComment == nil {
+				b.OpenComment = g
+			} else if e := innermost(p.elements, prev); e != nil {
+				e.Inner = append(e.Inner, g)
+			} else {
+				file.EndComments = append(file.EndComments, g)
+			}
+			continue
+		}
+
+		if e, ok := startsAt[next]; ok {
+			if e.Leading == nil && commentEndLine(last)+1 >= e.Pos.Line {
+				e.Leading = g
+			} else {
+				e.Detached = append(e.Detached, g)
+			}
+		} else if b, ok := closes[next]; ok {
+			b.EndComments = append(b.EndComments, g)
+		} else if e := innermost(p.elements, next); e != nil && p.tokens[next].kind != tokEOF {
+			e.Inner = append(e.Inner, g)
+		} else {
+			file.EndComments = append(file.EndComments, g)
+		}
+	}
+
+	for _, e := range p.elements {
+		start := e.Pos
+		if len(e.Detached) > 0 {
+			start = e.Detached[0].List[0].Pos
+		} else if e.Leading != nil {
+			start = e.Leading.List[0].Pos
+		}
+		e.BlankBefore = blankBefore(p.tokens, file.Comments, e.first, start)
+	}
+	for _, b := range p.blocks {
+		if len(b.EndComments) > 0 {
+			b.BlankBeforeEnd = blankBefore(p.tokens, file.Comments, b.close, b.EndComments[0].List[0].Pos)
+		}
+	}
+}
+
+// Groups comments on consecutive lines, unless they follow code on their line.
+func groupComments(tokens []token, comments []*Comment) []*CommentGroup {
+	var groups []*CommentGroup
+	var current *CommentGroup
+	for _, c := range comments {
+		prev := tokenBefore(tokens, c.Pos.Offset)
+		afterCode := prev >= 0 && tokens[prev].endPos.Line == c.Pos.Line
+		if current != nil && !afterCode {
+			last := current.List[len(current.List)-1]
+			// Nothing but space may come between the comments of a group
+			if commentEndLine(last)+1 >= c.Pos.Line && tokenBefore(tokens, last.Pos.Offset) == prev {
+				current.List = append(current.List, c)
+				continue
+			}
+		}
+		current = &CommentGroup{List: []*Comment{c}}
+		groups = append(groups, current)
+		// A trailing comment stands alone
+		if afterCode {
+			current = nil
+		}
+	}
+	return groups
+}
+
+// Returns the index of the last token before the offset, or -1.
+func tokenBefore(tokens []token, offset int) int {
+	lo, hi := 0, len(tokens)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if tokens[mid].endPos.Offset <= offset && tokens[mid].kind != tokEOF {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo - 1
+}
+
+// Returns the smallest element whose tokens include the token.
+func innermost(elements []*Element, index int) *Element {
+	var found *Element
+	for _, e := range elements {
+		if e.first <= index && index <= e.last && (found == nil || e.last-e.first < found.last-found.first) {
+			found = e
+		}
+	}
+	return found
+}
+
+func commentEndLine(c *Comment) int {
+	n := 0
+	for i := 0; i < len(c.Text); i++ {
+		if c.Text[i] == '\n' {
+			n += 1
+		}
+	}
+	return c.Pos.Line + n
+}
+
+// Returns whether a blank line separates what starts at the given position,
+// before the token with the given index, from the code or comment before it.
+func blankBefore(tokens []token, comments []*CommentGroup, index int, start Position) bool {
+	end := 0
+	if index > 0 {
+		end = tokens[index-1].endPos.Line
+	}
+	for _, g := range comments {
+		last := g.List[len(g.List)-1]
+		if last.Pos.Offset < start.Offset && commentEndLine(last) > end {
+			end = commentEndLine(last)
+		}
+	}
+	return end > 0 && start.Line > end+1
+}
@@ -0,0 +1,603 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package ast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parser builds the tree from the tokens of a file. Errors are raised as
+// panics with an *Error, which Parse recovers.
+type parser struct {
+	filename string
+	src      string
+	tokens   []token
+	i        int
+
+	elements []*Element
+	blocks   []*Block
+}
+
+// Parse parses the source of the .proto file with the given name.
+func Parse(filename string, src []byte) (file *File, err error) {
+	tokens, comments, err := scan(filename, string(src))
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{filename: filename, src: string(src), tokens: tokens}
+
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			file, err = nil, e
+		}
+	}()
+
+	file = &File{Name: filename}
+	for p.tok().kind != tokEOF {
+		file.Decls = append(file.Decls, p.parseFileDecl())
+	}
+	attachComments(file, p, comments)
+	return file, nil
+}
+
+func (this *parser) errorf(format string, args ...interface{}) {
+	panic(&Error{this.filename, this.tok().pos, fmt.Sprintf(format, args...)})
+}
+
+func (this *parser) tok() token {
+	return this.peek(0)
+}
+
+func (this *parser) peek(n int) token {
+	if this.i+n >= len(this.tokens) {
+		return this.tokens[len(this.tokens)-1]
+	}
+	return this.tokens[this.i+n]
+}
+
+func (this *parser) next() token {
+	t := this.tok()
+	if t.kind != tokEOF {
+		this.i += 1
+	}
+	return t
+}
+
+// Returns whether the current token is the given keyword or punctuation.
+func (this *parser) is(text string) bool {
+	t := this.tok()
+	return (t.kind == tokIdent || t.kind == tokPunct) && t.text == text
+}
+
+func (this *parser) expect(text string) token {
+	if !this.is(text) {
+		this.errorf("expected %q, found %s", text, this.describe())
+	}
+	return this.next()
+}
+
+func (this *parser) describe() string {
+	if this.tok().kind == tokEOF {
+		return "end of file"
+	}
+	return fmt.Sprintf("%q", this.tok().text)
+}
+
+func (this *parser) ident() string {
+	if this.tok().kind != tokIdent {
+		this.errorf("expected a name, found %s", this.describe())
+	}
+	return this.next().text
+}
+
+// Parses a dotted name, with a leading dot if allowed.
+func (this *parser) typeName() string {
+	name := ""
+	if this.is(".") {
+		name = this.next().text
+	}
+	name += this.ident()
+	for this.is(".") {
+		this.next()
+		name += "." + this.ident()
+	}
+	return name
+}
+
+func (this *parser) stringLiteral() string {
+	if this.tok().kind != tokString {
+		this.errorf("expected a string, found %s", this.describe())
+	}
+	return unquote(this.next().text)
+}
+
+func (this *parser) number() string {
+	sign := ""
+	if this.is("-") {
+		sign = this.next().text
+	}
+	if this.tok().kind != tokInt {
+		this.errorf("expected a number, found %s", this.describe())
+	}
+	return sign + this.next().text
+}
+
+// Starts an element at the current token.
+func (this *parser) start(e *Element) {
+	e.Pos = this.tok().pos
+	e.first = this.i
+}
+
+// Ends an element at the last token that was read.
+func (this *parser) finish(e *Element) {
+	e.last = this.i - 1
+	e.EndPos = this.tokens[e.last].endPos
+	this.elements = append(this.elements, e)
+}
+
+// Parses the braces of a block and the declarations between them.
+func (this *parser) parseBlock(b *Block, parseDecl func() Decl) {
+	b.Open = this.tok().pos
+	b.open = this.i
+	this.expect("{")
+	for !this.is("}") {
+		if this.tok().kind == tokEOF {
+			this.errorf("expected \"}\", found end of file")
+		}
+		b.Decls = append(b.Decls, parseDecl())
+	}
+	b.Close = this.tok().pos
+	b.close = this.i
+	this.next()
+	this.blocks = append(this.blocks, b)
+}
+
+func (this *parser) parseFileDecl() Decl {
+	switch {
+	case this.is("syntax"):
+		d := &Syntax{}
+		this.start(&d.Element)
+		this.next()
+		this.expect("=")
+		d.Value = this.stringLiteral()
+		this.expect(";")
+		this.finish(&d.Element)
+		return d
+	case this.is("package"):
+		d := &Package{}
+		this.start(&d.Element)
+		this.next()
+		d.Name = this.typeName()
+		this.expect(";")
+		this.finish(&d.Element)
+		return d
+	case this.is("import"):
+		d := &Import{}
+		this.start(&d.Element)
+		this.next()
+		if this.is("public") || this.is("weak") {
+			d.Modifier = this.next().text
+		}
+		d.Path = this.stringLiteral()
+		this.expect(";")
+		this.finish(&d.Element)
+		return d
+	case this.is("option"):
+		return this.parseOptionStatement()
+	case this.is("message"):
+		return this.parseMessage()
+	case this.is("enum"):
+		return this.parseEnum()
+	case this.is("service"):
+		return this.parseService()
+	case this.is("extend"):
+		return this.parseExtend()
+	case this.is(";"):
+		return this.parseEmpty()
+	}
+	this.errorf("unexpected %s", this.describe())
+	return nil
+}
+
+func (this *parser) parseEmpty() Decl {
+	d := &Empty{}
+	this.start(&d.Element)
+	this.expect(";")
+	this.finish(&d.Element)
+	return d
+}
+
+func (this *parser) parseMessage() Decl {
+	d := &Message{}
+	this.start(&d.Element)
+	this.expect("message")
+	d.Name = this.ident()
+	this.parseBlock(&d.Block, this.parseMessageDecl)
+	this.finish(&d.Element)
+	return d
+}
+
+// Like protoc, the keywords that start declarations cannot be the type of a
+// field in a message.
+func (this *parser) parseMessageDecl() Decl {
+	switch {
+	case this.is("message"):
+		return this.parseMessage()
+	case this.is("enum"):
+		return this.parseEnum()
+	case this.is("extend"):
+		return this.parseExtend()
+	case this.is("option"):
+		return this.parseOptionStatement()
+	case this.is("oneof"):
+		return this.parseOneof()
+	case this.is("extensions"):
+		return this.parseExtensions()
+	case this.is("reserved"):
+		return this.parseReserved()
+	case this.is(";"):
+		return this.parseEmpty()
+	}
+	return this.parseField(true)
+}
+
+// Parses a field or a group, with a label if allowed.
+func (this *parser) parseField(label bool) Decl {
+	var e Element
+	this.start(&e)
+	l := ""
+	if label && (this.is("optional") || this.is("required") || this.is("repeated")) {
+		l = this.next().text
+	}
+
+	if this.is("group") && this.peek(1).kind == tokIdent {
+		d := &Group{Element: e, Label: l}
+		this.next()
+		d.Name = this.ident()
+		this.expect("=")
+		d.Number = this.number()
+		d.Options = this.parseOptionList()
+		this.parseBlock(&d.Block, this.parseMessageDecl)
+		this.finish(&d.Element)
+		return d
+	}
+
+	d := &Field{Element: e, Label: l}
+	if this.is("map") && this.peek(1).kind == tokPunct && this.peek(1).text == "<" {
+		this.next()
+		this.expect("<")
+		key := this.typeName()
+		this.expect(",")
+		value := this.typeName()
+		this.expect(">")
+		d.Type = "map<" + key + ", " + value + ">"
+	} else {
+		d.Type = this.typeName()
+	}
+	d.Name = this.ident()
+	this.expect("=")
+	d.Number = this.number()
+	d.Options = this.parseOptionList()
+	this.expect(";")
+	this.finish(&d.Element)
+	return d
+}
+
+func (this *parser) parseOneof() Decl {
+	d := &Oneof{}
+	this.start(&d.Element)
+	this.expect("oneof")
+	d.Name = this.ident()
+	this.parseBlock(&d.Block, func() Decl {
+		switch {
+		case this.is("option"):
+			return this.parseOptionStatement()
+		case this.is(";"):
+			return this.parseEmpty()
+		}
+		return this.parseField(false)
+	})
+	this.finish(&d.Element)
+	return d
+}
+
+func (this *parser) parseEnum() Decl {
+	d := &Enum{}
+	this.start(&d.Element)
+	this.expect("enum")
+	d.Name = this.ident()
+	this.parseBlock(&d.Block, func() Decl {
+		switch {
+		case this.is("option"):
+			return this.parseOptionStatement()
+		case this.is("reserved"):
+			return this.parseReserved()
+		case this.is(";"):
+			return this.parseEmpty()
+		}
+		v := &EnumValue{}
+		this.start(&v.Element)
+		v.Name = this.ident()
+		this.expect("=")
+		v.Number = this.number()
+		v.Options = this.parseOptionList()
+		this.expect(";")
+		this.finish(&v.Element)
+		return v
+	})
+	this.finish(&d.Element)
+	return d
+}
+
+func (this *parser) parseService() Decl {
+	d := &Service{}
+	this.start(&d.Element)
+	this.expect("service")
+	d.Name = this.ident()
+	this.parseBlock(&d.Block, func() Decl {
+		switch {
+		case this.is("option"):
+			return this.parseOptionStatement()
+		case this.is("rpc"):
+			return this.parseRPC()
+		case this.is(";"):
+			return this.parseEmpty()
+		}
+		this.errorf("unexpected %s in service", this.describe())
+		return nil
+	})
+	this.finish(&d.Element)
+	return d
+}
+
+func (this *parser) parseRPC() Decl {
+	d := &RPC{}
+	this.start(&d.Element)
+	this.expect("rpc")
+	d.Name = this.ident()
+	this.expect("(")
+	if this.is("stream") && !(this.peek(1).kind == tokPunct && this.peek(1).text == ")") {
+		this.next()
+		d.InputStream = true
+	}
+	d.Input = this.typeName()
+	this.expect(")")
+	this.expect("returns")
+	this.expect("(")
+	if this.is("stream") && !(this.peek(1).kind == tokPunct && this.peek(1).text == ")") {
+		this.next()
+		d.OutputStream = true
+	}
+	d.Output = this.typeName()
+	this.expect(")")
+	if this.is("{") {
+		d.HasBody = true
+		this.parseBlock(&d.Block, func() Decl {
+			switch {
+			case this.is("option"):
+				return this.parseOptionStatement()
+			case this.is(";"):
+				return this.parseEmpty()
+			}
+			this.errorf("unexpected %s in rpc", this.describe())
+			return nil
+		})
+	} else {
+		this.expect(";")
+	}
+	this.finish(&d.Element)
+	return d
+}
+
+func (this *parser) parseExtend() Decl {
+	d := &Extend{}
+	this.start(&d.Element)
+	this.expect("extend")
+	d.Extendee = this.typeName()
+	this.parseBlock(&d.Block, func() Decl {
+		if this.is(";") {
+			return this.parseEmpty()
+		}
+		return this.parseField(true)
+	})
+	this.finish(&d.Element)
+	return d
+}
+
+func (this *parser) parseExtensions() Decl {
+	d := &Extensions{}
+	this.start(&d.Element)
+	this.expect("extensions")
+	d.Ranges = this.parseRanges()
+	d.Options = this.parseOptionList()
+	this.expect(";")
+	this.finish(&d.Element)
+	return d
+}
+
+func (this *parser) parseReserved() Decl {
+	d := &Reserved{}
+	this.start(&d.Element)
+	this.expect("reserved")
+	if this.tok().kind == tokString {
+		d.Names = append(d.Names, this.stringLiteral())
+		for this.is(",") {
+			this.next()
+			d.Names = append(d.Names, this.stringLiteral())
+		}
+	} else {
+		d.Ranges = this.parseRanges()
+	}
+	this.expect(";")
+	this.finish(&d.Element)
+	return d
+}
+
+func (this *parser) parseRanges() []*Range {
+	var ranges []*Range
+	for {
+		r := &Range{Start: this.number()}
+		if this.is("to") {
+			this.next()
+			if this.is("max") {
+				r.End = this.next().text
+			} else {
+				r.End = this.number()
+			}
+		}
+		ranges = append(ranges, r)
+		if !this.is(",") {
+			return ranges
+		}
+		this.next()
+	}
+}
+
+func (this *parser) parseOptionStatement() Decl {
+	d := &Option{}
+	this.start(&d.Element)
+	this.expect("option")
+	d.Name = this.optionName()
+	this.expect("=")
+	d.Value = this.parseValue()
+	this.expect(";")
+	this.finish(&d.Element)
+	return d
+}
+
+// Parses the options between brackets, if there are any. The options are not
+// declarations of their own, comments between them belong to the declaration
+// of the list.
+func (this *parser) parseOptionList() []*Option {
+	if !this.is("[") {
+		return nil
+	}
+	this.next()
+	var opts []*Option
+	for {
+		o := &Option{}
+		o.Pos = this.tok().pos
+		o.first = this.i
+		o.Name = this.optionName()
+		this.expect("=")
+		o.Value = this.parseValue()
+		o.last = this.i - 1
+		o.EndPos = this.tokens[o.last].endPos
+		opts = append(opts, o)
+		if !this.is(",") {
+			break
+		}
+		this.next()
+	}
+	this.expect("]")
+	return opts
+}
+
+// Parses an option name, such as java_package, (my.opt) or (.my.opt).field.
+func (this *parser) optionName() string {
+	name := ""
+	for {
+		if this.is("(") {
+			this.next()
+			name += "(" + this.typeName() + ")"
+			this.expect(")")
+		} else {
+			name += this.ident()
+		}
+		if !this.is(".") {
+			return name
+		}
+		name += this.next().text
+	}
+}
+
+func (this *parser) parseValue() *Value {
+	v := &Value{Pos: this.tok().pos}
+	switch t := this.tok(); {
+	case this.is("{"):
+		v.Kind = AggregateValue
+		depth := 0
+		for {
+			if this.tok().kind == tokEOF {
+				this.errorf("expected \"}\", found end of file")
+			}
+			if this.is("{") {
+				depth += 1
+			} else if this.is("}") {
+				depth -= 1
+			}
+			end := this.next()
+			if depth == 0 {
+				v.Text = this.src[t.pos.Offset:end.endPos.Offset]
+				return v
+			}
+		}
+	case t.kind == tokString:
+		v.Kind = StringValue
+		var parts []string
+		for this.tok().kind == tokString {
+			parts = append(parts, this.next().text)
+		}
+		v.Text = strings.Join(parts, " ")
+	case this.is("-") || this.is("+"):
+		sign := this.next().text
+		v.Text, v.Kind = this.parseValue().Text, this.tokens[this.i-1].valueKind()
+		if sign == "-" {
+			v.Text = sign + v.Text
+		}
+	case t.kind == tokInt || t.kind == tokFloat || t.kind == tokIdent:
+		v.Kind = this.next().valueKind()
+		v.Text = t.text
+	default:
+		this.errorf("expected a value, found %s", this.describe())
+	}
+	return v
+}
+
+func (this token) valueKind() ValueKind {
+	switch this.kind {
+	case tokInt:
+		return IntValue
+	case tokFloat:
+		return FloatValue
+	case tokString:
+		return StringValue
+	}
+	return IdentifierValue
+}
+
+// Strips the quotes of a string literal, leaving the escapes as they are.
+func unquote(s string) string {
+	if len(s) >= 2 {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
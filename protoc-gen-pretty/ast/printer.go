@@ -0,0 +1,259 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package ast
+
+import (
+	"strings"
+)
+
+const indent = "  "
+
+// Fmt prints the file in the style of the formatter. The declarations keep
+// the order and comments of the source, and a blank line between
+// declarations is kept. Top-level blocks and the groups of statements of
+// different kinds are always separated by a blank line.
+func (this *File) Fmt() string {
+	var s []string
+	s = append(s, fmtDecls(this.Decls, 0, true))
+	if len(this.EndComments) > 0 && len(this.Decls) > 0 {
+		s = append(s, "\n")
+	}
+	for i, g := range this.EndComments {
+		if i > 0 {
+			s = append(s, "\n")
+		}
+		s = append(s, fmtComments(g, 0))
+	}
+	return strings.Join(s, "")
+}
+
+func fmtDecls(decls []Decl, depth int, top bool) string {
+	var s []string
+	var prev Decl
+	for _, decl := range decls {
+		e := decl.Base()
+		if _, ok := decl.(*Empty); ok && e.Leading == nil && e.Trailing == nil && len(e.Detached) == 0 && len(e.Inner) == 0 {
+			continue
+		}
+		if prev != nil && (e.BlankBefore || top && (isBlock(decl) || isBlock(prev) || kind(decl) != kind(prev))) {
+			s = append(s, "\n")
+		}
+		s = append(s, fmtDecl(decl, depth))
+		prev = decl
+	}
+	return strings.Join(s, "")
+}
+
+// Returns whether the declaration is printed as a block.
+func isBlock(decl Decl) bool {
+	switch d := decl.(type) {
+	case *Message, *Enum, *Service, *Extend, *Group, *Oneof:
+		return true
+	case *RPC:
+		return d.HasBody
+	}
+	return false
+}
+
+// Returns the kind of statement, to keep kinds apart at the top level.
+func kind(decl Decl) string {
+	switch decl.(type) {
+	case *Syntax:
+		return "syntax"
+	case *Package:
+		return "package"
+	case *Import:
+		return "import"
+	case *Option:
+		return "option"
+	}
+	return ""
+}
+
+func fmtDecl(decl Decl, depth int) string {
+	e := decl.Base()
+	var s []string
+	for _, g := range e.Detached {
+		s = append(s, fmtComments(g, depth))
+		s = append(s, "\n")
+	}
+	if e.Leading != nil {
+		s = append(s, fmtComments(e.Leading, depth))
+	}
+	for _, g := range e.Inner {
+		s = append(s, fmtComments(g, depth))
+	}
+	if _, ok := decl.(*Empty); ok {
+		// Only the comments are left of a lone semicolon
+		if e.Trailing != nil {
+			s = append(s, fmtComments(e.Trailing, depth))
+		}
+		return strings.Join(s, "")
+	}
+
+	s = append(s, getIndentation(depth))
+	s = append(s, declText(decl, depth))
+	if e.Trailing != nil {
+		s = append(s, " ")
+		s = append(s, strings.TrimPrefix(fmtComments(e.Trailing, depth), getIndentation(depth)))
+	} else {
+		s = append(s, "\n")
+	}
+	return strings.Join(s, "")
+}
+
+// Returns the declaration without indentation before it or a newline after it.
+func declText(decl Decl, depth int) string {
+	switch d := decl.(type) {
+	case *Syntax:
+		return `syntax = "` + d.Value + `";`
+	case *Package:
+		return "package " + d.Name + ";"
+	case *Import:
+		if len(d.Modifier) > 0 {
+			return "import " + d.Modifier + ` "` + d.Path + `";`
+		}
+		return `import "` + d.Path + `";`
+	case *Option:
+		return "option " + d.Name + " = " + d.Value.Text + ";"
+	case *Message:
+		return fmtBlock("message "+d.Name, &d.Block, depth, "}")
+	case *Field:
+		return label(d.Label) + d.Type + " " + d.Name + " = " + d.Number + fmtOptionList(d.Options) + ";"
+	case *Group:
+		return fmtBlock(label(d.Label)+"group "+d.Name+" = "+d.Number+fmtOptionList(d.Options), &d.Block, depth, "}")
+	case *Oneof:
+		return fmtBlock("oneof "+d.Name, &d.Block, depth, "}")
+	case *Enum:
+		return fmtBlock("enum "+d.Name, &d.Block, depth, "};")
+	case *EnumValue:
+		return d.Name + " = " + d.Number + fmtOptionList(d.Options) + ";"
+	case *Service:
+		return fmtBlock("service "+d.Name, &d.Block, depth, "}")
+	case *RPC:
+		signature := "rpc " + d.Name + "(" + stream(d.InputStream) + d.Input + ") returns(" + stream(d.OutputStream) + d.Output + ")"
+		if !d.HasBody {
+			return signature + ";"
+		}
+		return fmtBlock(signature, &d.Block, depth, "}")
+	case *Extend:
+		return fmtBlock("extend "+d.Extendee, &d.Block, depth, "}")
+	case *Extensions:
+		return "extensions " + fmtRanges(d.Ranges) + fmtOptionList(d.Options) + ";"
+	case *Reserved:
+		if len(d.Names) > 0 {
+			return `reserved "` + strings.Join(d.Names, `", "`) + `";`
+		}
+		return "reserved " + fmtRanges(d.Ranges) + ";"
+	}
+	return ""
+}
+
+func label(l string) string {
+	if len(l) == 0 {
+		return ""
+	}
+	return l + " "
+}
+
+func stream(s bool) string {
+	if s {
+		return "stream "
+	}
+	return ""
+}
+
+func fmtBlock(header string, b *Block, depth int, end string) string {
+	var s []string
+	s = append(s, header)
+	s = append(s, " {")
+	if b.OpenComment != nil {
+		s = append(s, " ")
+		s = append(s, strings.TrimPrefix(fmtComments(b.OpenComment, depth+1), getIndentation(depth+1)))
+	} else {
+		s = append(s, "\n")
+	}
+	s = append(s, fmtDecls(b.Decls, depth+1, false))
+	if b.BlankBeforeEnd && len(b.Decls) > 0 {
+		s = append(s, "\n")
+	}
+	for _, g := range b.EndComments {
+		s = append(s, fmtComments(g, depth+1))
+	}
+	s = append(s, getIndentation(depth))
+	s = append(s, end)
+	return strings.Join(s, "")
+}
+
+// Options between brackets are printed like those of the formatter: a=b.
+func fmtOptionList(opts []*Option) string {
+	if len(opts) == 0 {
+		return ""
+	}
+	var s []string
+	for _, opt := range opts {
+		s = append(s, opt.Name+"="+opt.Value.Text)
+	}
+	return " [" + strings.Join(s, ", ") + "]"
+}
+
+func fmtRanges(ranges []*Range) string {
+	var s []string
+	for _, r := range ranges {
+		if len(r.End) > 0 {
+			s = append(s, r.Start+" to "+r.End)
+		} else {
+			s = append(s, r.Start)
+		}
+	}
+	return strings.Join(s, ", ")
+}
+
+// Prints the comments of the group as they are written, one per line at the
+// given depth. The lines of a block comment keep their indentation relative
+// to the first one.
+func fmtComments(g *CommentGroup, depth int) string {
+	var s []string
+	for _, c := range g.List {
+		lines := strings.Split(c.Text, "\n")
+		for i, line := range lines {
+			if i > 0 {
+				// Take away the indentation of the comment in the source
+				for n := 1; n < c.Pos.Column && len(line) > 0 && (line[0] == ' ' || line[0] == '\t'); n++ {
+					line = line[1:]
+				}
+			}
+			s = append(s, getIndentation(depth))
+			s = append(s, strings.TrimRight(line, " \t\r"))
+			s = append(s, "\n")
+		}
+	}
+	return strings.Join(s, "")
+}
+
+func getIndentation(depth int) string {
+	return strings.Repeat(indent, depth)
+}
@@ -0,0 +1,209 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package ast
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokInt
+	tokFloat
+	tokString
+	tokPunct
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	pos    Position
+	endPos Position
+}
+
+// Error is an error in the source of a file.
+type Error struct {
+	Filename string
+	Pos      Position
+	Msg      string
+}
+
+func (this *Error) Error() string {
+	return fmt.Sprintf("%s:%v: %s", this.Filename, this.Pos, this.Msg)
+}
+
+// scanner splits a source file into tokens and comments.
+type scanner struct {
+	filename string
+	src      string
+	pos      Position
+
+	tokens   []token
+	comments []*Comment
+}
+
+// Scans the whole file.
+func scan(filename string, src string) ([]token, []*Comment, error) {
+	s := &scanner{filename: filename, src: src, pos: Position{0, 1, 1}}
+	for {
+		s.skipSpace()
+		if s.pos.Offset >= len(s.src) {
+			break
+		}
+		start := s.pos
+		c := s.src[s.pos.Offset]
+		switch {
+		case strings.HasPrefix(s.src[s.pos.Offset:], "//"):
+			end := strings.Index(s.src[s.pos.Offset:], "\n")
+			if end < 0 {
+				end = len(s.src) - s.pos.Offset
+			}
+			s.advance(end)
+			s.comments = append(s.comments, &Comment{start, strings.TrimRight(s.src[start.Offset:s.pos.Offset], " \t\r")})
+			continue
+		case strings.HasPrefix(s.src[s.pos.Offset:], "/*"):
+			end := strings.Index(s.src[s.pos.Offset+2:], "*/")
+			if end < 0 {
+				return nil, nil, &Error{filename, start, "comment not terminated"}
+			}
+			s.advance(end + 4)
+			s.comments = append(s.comments, &Comment{start, s.src[start.Offset:s.pos.Offset]})
+			continue
+		case isLetter(c):
+			s.advanceWhile(func(c byte) bool { return isLetter(c) || isDigit(c) })
+			s.emit(tokIdent, start)
+		case isDigit(c) || c == '.' && s.pos.Offset+1 < len(s.src) && isDigit(s.src[s.pos.Offset+1]):
+			s.emit(s.scanNumber(), start)
+		case c == '"' || c == '\'':
+			if err := s.scanString(c); err != nil {
+				return nil, nil, err
+			}
+			s.emit(tokString, start)
+		case strings.IndexByte(";{}[]()<>=,.-+:", c) >= 0:
+			s.advance(1)
+			s.emit(tokPunct, start)
+		default:
+			return nil, nil, &Error{filename, start, fmt.Sprintf("unexpected character %q", c)}
+		}
+	}
+	s.tokens = append(s.tokens, token{kind: tokEOF, pos: s.pos, endPos: s.pos})
+	return s.tokens, s.comments, nil
+}
+
+func (this *scanner) emit(kind tokenKind, start Position) {
+	this.tokens = append(this.tokens, token{kind, this.src[start.Offset:this.pos.Offset], start, this.pos})
+}
+
+// Moves n bytes ahead, keeping track of lines and columns.
+func (this *scanner) advance(n int) {
+	for i := 0; i < n && this.pos.Offset < len(this.src); i++ {
+		if this.src[this.pos.Offset] == '\n' {
+			this.pos.Line += 1
+			this.pos.Column = 1
+		} else {
+			this.pos.Column += 1
+		}
+		this.pos.Offset += 1
+	}
+}
+
+func (this *scanner) advanceWhile(f func(c byte) bool) {
+	for this.pos.Offset < len(this.src) && f(this.src[this.pos.Offset]) {
+		this.advance(1)
+	}
+}
+
+func (this *scanner) skipSpace() {
+	this.advanceWhile(func(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v' })
+}
+
+// Scans a decimal, octal or hexadecimal integer, or a float.
+func (this *scanner) scanNumber() tokenKind {
+	src := this.src[this.pos.Offset:]
+	if strings.HasPrefix(src, "0x") || strings.HasPrefix(src, "0X") {
+		this.advance(2)
+		this.advanceWhile(isHexDigit)
+		return tokInt
+	}
+
+	kind := tokInt
+	this.advanceWhile(isDigit)
+	if this.pos.Offset < len(this.src) && this.src[this.pos.Offset] == '.' {
+		kind = tokFloat
+		this.advance(1)
+		this.advanceWhile(isDigit)
+	}
+	if this.pos.Offset < len(this.src) && (this.src[this.pos.Offset] == 'e' || this.src[this.pos.Offset] == 'E') {
+		kind = tokFloat
+		this.advance(1)
+		if this.pos.Offset < len(this.src) && (this.src[this.pos.Offset] == '+' || this.src[this.pos.Offset] == '-') {
+			this.advance(1)
+		}
+		this.advanceWhile(isDigit)
+	}
+	// protoc accepts a suffix f on floats
+	if this.pos.Offset < len(this.src) && (this.src[this.pos.Offset] == 'f' || this.src[this.pos.Offset] == 'F') {
+		kind = tokFloat
+		this.advance(1)
+	}
+	return kind
+}
+
+// Scans a string quoted by the given character, with its escapes.
+func (this *scanner) scanString(quote byte) error {
+	start := this.pos
+	this.advance(1)
+	for this.pos.Offset < len(this.src) {
+		switch this.src[this.pos.Offset] {
+		case quote:
+			this.advance(1)
+			return nil
+		case '\\':
+			this.advance(2)
+		case '\n':
+			return &Error{this.filename, start, "string not terminated"}
+		default:
+			this.advance(1)
+		}
+	}
+	return &Error{this.filename, start, "string not terminated"}
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
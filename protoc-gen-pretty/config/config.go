@@ -0,0 +1,133 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+// Package config reads the formatting style from .protofmt.yaml files.
+//
+// A configuration file applies to every .proto file in its directory and the
+// directories below it. Files nearer to the .proto file override the settings
+// of the files above them. The format is a flat list of settings:
+//
+//	# Four spaces per level
+//	indent: 4
+//	enum_semicolon: false
+//	option_order: source
+package config
+
+import (
+	"fmt"
+	descriptor "github.com/DirkBrand/protobuf-code-formatter/protoc-gen-pretty/descriptor"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The name of the configuration file
+const FileName = ".protofmt.yaml"
+
+// ForFile returns the style for the given .proto file: the base style with the
+// settings of every configuration file from the root down to the directory of
+// the file applied in turn.
+func ForFile(filename string, base *descriptor.Style) (*descriptor.Style, error) {
+	style := *base
+
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []string
+	dir := filepath.Dir(abs)
+	for {
+		configs = append(configs, filepath.Join(dir, FileName))
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	for i := len(configs) - 1; i >= 0; i-- {
+		content, err := ioutil.ReadFile(configs[i])
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if err := Parse(configs[i], content, &style); err != nil {
+			return nil, err
+		}
+	}
+
+	return &style, nil
+}
+
+// Parse applies the settings in the content of a configuration file to the
+// style. The filename is only used in errors.
+func Parse(filename string, content []byte, style *descriptor.Style) error {
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(stripComment(line))
+		if len(line) == 0 || line == "---" {
+			continue
+		}
+
+		ind := strings.Index(line, ":")
+		if ind < 0 {
+			return fmt.Errorf("%s:%d: expected key: value", filename, i+1)
+		}
+		key := strings.TrimSpace(line[:ind])
+		value := unquote(strings.TrimSpace(line[ind+1:]))
+		if err := style.Set(key, value); err != nil {
+			return fmt.Errorf("%s:%d: %v", filename, i+1, err)
+		}
+	}
+	return nil
+}
+
+// stripComment removes the comment from the end of the line.  A "#" inside a
+// quoted value does not start a comment.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
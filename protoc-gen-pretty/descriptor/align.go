@@ -0,0 +1,139 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package descriptor
+
+import (
+	strings "strings"
+	utf8 "unicode/utf8"
+)
+
+// When the style aligns declarations, the printer marks the cells of fields
+// and enum values and the start of their trailing comments, and alignCells
+// lines them up once the whole file is printed.
+const (
+	cellMark    = "\x00"
+	commentMark = "\x01"
+)
+
+// Returns what separates two cells of a declaration.
+func cellBreak() string {
+	if currentStyle.Align {
+		return cellMark
+	}
+	return " "
+}
+
+// Returns the trailing comment of a declaration, marked for alignment if both
+// take up a single line.  The comment after options that were wrapped onto
+// lines of their own follows the closing bracket.
+func alignedTrailingComment(declaration string, tc string) string {
+	if !currentStyle.Align || strings.Count(tc, "\n") != 1 {
+		return tc
+	}
+	if strings.Contains(declaration, "\n") {
+		return " " + strings.TrimSpace(tc) + "\n"
+	}
+	return commentMark + strings.TrimSpace(tc) + "\n"
+}
+
+// alignCells aligns the cells of each block of consecutive marked lines. A
+// cell is only padded when another cell follows it on the line, and trailing
+// comments line up one space after the longest declaration of the block that
+// fits on a line.
+func alignCells(s string) string {
+	if !strings.Contains(s, cellMark) && !strings.Contains(s, commentMark) {
+		return s
+	}
+
+	lines := strings.Split(s, "\n")
+	for start := 0; start < len(lines); start++ {
+		if !isMarked(lines[start]) {
+			continue
+		}
+		end := start
+		for end < len(lines) && isMarked(lines[end]) {
+			end++
+		}
+		alignBlock(lines[start:end])
+		start = end
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isMarked(line string) bool {
+	return strings.Contains(line, cellMark) || strings.Contains(line, commentMark)
+}
+
+func alignBlock(lines []string) {
+	cells := make([][]string, len(lines))
+	comments := make([]string, len(lines))
+	var widths []int
+	for i, line := range lines {
+		if ind := strings.Index(line, commentMark); ind >= 0 {
+			line, comments[i] = line[:ind], line[ind+len(commentMark):]
+		}
+		cells[i] = strings.Split(line, cellMark)
+		for j, cell := range cells[i][:len(cells[i])-1] {
+			if j == len(widths) {
+				widths = append(widths, 0)
+			}
+			if cellWidth(cell) > widths[j] {
+				widths[j] = cellWidth(cell)
+			}
+		}
+	}
+
+	declarationWidth := 0
+	for i := range lines {
+		var s []string
+		for j, cell := range cells[i] {
+			if j < len(cells[i])-1 {
+				cell += strings.Repeat(" ", widths[j]-cellWidth(cell)+1)
+			}
+			s = append(s, cell)
+		}
+		lines[i] = strings.Join(s, "")
+		// The first line of wrapped options has no comment to line up
+		if cells[i][len(cells[i])-1] == "[" {
+			continue
+		}
+		if cellWidth(lines[i]) > declarationWidth {
+			declarationWidth = cellWidth(lines[i])
+		}
+	}
+
+	for i := range lines {
+		if len(comments[i]) > 0 {
+			lines[i] += strings.Repeat(" ", declarationWidth-cellWidth(lines[i])+1) + comments[i]
+		}
+	}
+}
+
+// Returns the number of characters in the cell, which is the number of
+// columns it takes up when it holds no tabs.
+func cellWidth(text string) int {
+	return utf8.RuneCountInString(text)
+}
@@ -0,0 +1,221 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package descriptor
+
+import (
+	regexp "regexp"
+	strings "strings"
+)
+
+// Lines that look like commented-out declarations: fields, enum values,
+// options and other statements, the start of a block or its end.
+var codeLine = regexp.MustCompile(`^\s*(` +
+	`((optional|required|repeated)\s+)?[\w.<>, ]+\s+\w+\s*=\s*-?\w+\s*(\[.*\])?\s*;|` +
+	`\w+\s*=\s*-?\w+\s*(\[.*\])?\s*;|` +
+	`option\s+[\w().]+\s*=.*;|` +
+	`(import|package|syntax|reserved|extensions)\b.*;|` +
+	`(message|enum|service|extend|oneof)\s+[\w.]+\s*\{.*|` +
+	`rpc\s+\w+\s*\(.*|` +
+	`\}\s*;?` +
+	`)\s*(//.*)?$`)
+
+// Lines that start an item of a list: "- a", "* a", "+ a", "1. a" or "1) a".
+var listItem = regexp.MustCompile(`^([-*+]|[0-9]+[.)])\s+`)
+
+// Returns the comment text as normalized "//" lines at the given depth.
+func normalizedComment(text string, depth int) string {
+	indentation := getIndentation(depth)
+	width := currentStyle.CommentWidth - lineWidth(indentation+"//")
+
+	var s []string
+	for _, line := range normalizeComment(text, width) {
+		s = append(s, indentation, "//", line, "\n")
+	}
+	return strings.Join(s, "")
+}
+
+// normalizeComment returns the lines of the comment text, as they follow the
+// comment marker. Every line gets one space after the marker and paragraphs
+// are reflowed to the given width. Lists keep their items, and code, either
+// indented or between ``` fences, is kept as it is, and so are lines that look
+// like commented-out declarations. A paragraph of which every line looks like
+// one is not touched at all.
+func normalizeComment(text string, width int) []string {
+	if width < 20 {
+		width = 20
+	}
+
+	lines := strings.Split(text, "\n")
+
+	// The indentation common to the lines with a space after the marker is
+	// that of the text, unless most lines have none
+	indent := -1
+	spaced, unspaced := 0, 0
+	for _, line := range lines {
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") {
+			unspaced += 1
+			continue
+		}
+		spaced += 1
+		n := len(line) - len(strings.TrimLeft(line, " "))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	if spaced < unspaced || indent < 0 {
+		indent = 0
+	}
+
+	var s []string
+	for _, paragraph := range commentParagraphs(lines) {
+		if len(s) > 0 {
+			s = append(s, "")
+		}
+		s = append(s, normalizeParagraph(paragraph, indent, width)...)
+	}
+	return s
+}
+
+// Splits the lines of a comment at blank lines, except inside ``` fences.
+func commentParagraphs(lines []string) [][]string {
+	var paragraphs [][]string
+	var current []string
+	fenced := false
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			fenced = !fenced
+		}
+		if !fenced && len(strings.TrimSpace(line)) == 0 {
+			if len(current) > 0 {
+				paragraphs = append(paragraphs, current)
+				current = nil
+			}
+			continue
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		paragraphs = append(paragraphs, current)
+	}
+	return paragraphs
+}
+
+// Returns whether every line of the paragraph looks like a declaration.
+func commentedOutCode(lines []string) bool {
+	for _, line := range lines {
+		if !codeLine.MatchString(line) {
+			return false
+		}
+	}
+	return true
+}
+
+// Reflows the paragraph of a comment whose text is indented by the given
+// number of spaces. Lines that look like declarations are kept as they are.
+func normalizeParagraph(lines []string, indent int, width int) []string {
+	if commentedOutCode(lines) {
+		return lines
+	}
+
+	var s []string
+	var words []string
+	hanging := ""
+	flush := func() {
+		s = append(s, wrapWords(words, hanging, width)...)
+		words = nil
+		hanging = ""
+	}
+
+	fenced := false
+	for _, line := range lines {
+		line = line[leadingSpaces(line, indent):]
+		line = strings.TrimRight(line, " \t")
+		trimmed := strings.TrimSpace(line)
+
+		// List items, which may be indented below the text
+		if m := listItem.FindString(trimmed); len(m) > 0 && !fenced {
+			flush()
+			prefix := line[:len(line)-len(trimmed)]
+			hanging = prefix + strings.Repeat(" ", len(m))
+			words = append(words, prefix+strings.TrimSpace(m))
+			words = append(words, strings.Fields(trimmed[len(m):])...)
+			continue
+		}
+
+		// Fences, the code in them or indented below the text, and
+		// commented-out declarations
+		if strings.HasPrefix(trimmed, "```") || fenced || strings.HasPrefix(line, "  ") && len(hanging) == 0 || strings.HasPrefix(line, "\t") || codeLine.MatchString(line) {
+			if strings.HasPrefix(trimmed, "```") {
+				fenced = !fenced
+			}
+			flush()
+			s = append(s, strings.TrimRight(" "+line, " "))
+			continue
+		}
+
+		words = append(words, strings.Fields(trimmed)...)
+	}
+	flush()
+	return s
+}
+
+// Returns the number of spaces the line starts with, up to max.
+func leadingSpaces(line string, max int) int {
+	n := 0
+	for n < len(line) && n < max && line[n] == ' ' {
+		n += 1
+	}
+	return n
+}
+
+// Fills lines of the given width with the words, each line starting with a
+// space after the comment marker. The lines after the first are indented by
+// the hanging indentation, as for the items of a list.
+func wrapWords(words []string, hanging string, width int) []string {
+	var s []string
+	line := ""
+	for _, word := range words {
+		switch {
+		case len(line) == 0:
+			line = " " + word
+			if len(s) > 0 {
+				line = " " + hanging + word
+			}
+		case lineWidth(line)+1+lineWidth(word) > width:
+			s = append(s, line)
+			line = " " + hanging + word
+		default:
+			line += " " + word
+		}
+	}
+	if len(line) > 0 {
+		s = append(s, line)
+	}
+	return s
+}
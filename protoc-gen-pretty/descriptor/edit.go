@@ -0,0 +1,1012 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package descriptor
+
+import (
+	proto "code.google.com/p/gogoprotobuf/proto"
+	fmt "fmt"
+	strings "strings"
+)
+
+// Edit returns the file of the set with the given name, so that it can be
+// changed through the methods of its descriptors, or nil if the set has no
+// such file.  The changes are made to the descriptors of the set itself and
+// formatting the set afterwards prints them.  Elements keep their comments,
+// also when the elements before them are removed.  Type names are resolved
+// against all the files of the set, so only one set can be edited at a time.
+func (this *FileDescriptorSet) Edit(fileName string) *FileDescriptor {
+	return this.WrapFile(fileName)
+}
+
+// LookupMessage returns the message with the given name, relative to the
+// package of the file, or nil if there is none.  Nested messages are named
+// through the messages that contain them: Outer.Inner.
+func (this *FileDescriptor) LookupMessage(name string) *Descriptor {
+	var parent *Descriptor
+	messages := this.MessageType
+	for _, part := range strings.Split(name, ".") {
+		index := messageIndex(messages, part)
+		if index < 0 {
+			return nil
+		}
+		parent = newDescriptor(messages[index], parent, this.FileDescriptorProto, index)
+		messages = parent.NestedType
+	}
+	return parent
+}
+
+// LookupEnum returns the enum with the given name, relative to the package of
+// the file, or nil if there is none.  Enums inside messages are named through
+// the messages that contain them: Outer.Kind.
+func (this *FileDescriptor) LookupEnum(name string) *EnumDescriptor {
+	enums := this.EnumType
+	var parent *Descriptor
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		if parent = this.LookupMessage(name[:i]); parent == nil {
+			return nil
+		}
+		enums, name = parent.EnumType, name[i+1:]
+	}
+	index := enumIndex(enums, name)
+	if index < 0 {
+		return nil
+	}
+	return newEnumDescriptor(enums[index], parent, this.FileDescriptorProto, index)
+}
+
+// LookupService returns the service with the given name, or nil if there is
+// none.
+func (this *FileDescriptor) LookupService(name string) *ServiceDescriptor {
+	for i, service := range this.Service {
+		if service.GetName() == name {
+			return newServiceDescriptor(service, this.FileDescriptorProto, i)
+		}
+	}
+	return nil
+}
+
+// LookupField returns the field of the message with the given name, or nil if
+// there is none.
+func (this *Descriptor) LookupField(name string) *FieldDescriptor {
+	path, err := this.pathOf()
+	if err != nil {
+		return nil
+	}
+	for i, field := range this.Field {
+		if field.GetName() == name {
+			return &FieldDescriptor{this.common, field, this, path.child(messageFieldPath, i).String()}
+		}
+	}
+	return nil
+}
+
+// AddImport adds an import of the file with the given name.
+func (this *FileDescriptor) AddImport(fileName string) error {
+	for _, dependency := range this.Dependency {
+		if dependency == fileName {
+			return fmt.Errorf("%s already imports %s", this.GetName(), fileName)
+		}
+	}
+	this.Dependency = append(this.Dependency, fileName)
+	return nil
+}
+
+// RemoveImport removes the import of the file with the given name.  What the
+// file uses from the import is left as it is.
+func (this *FileDescriptor) RemoveImport(fileName string) error {
+	index := -1
+	for i, dependency := range this.Dependency {
+		if dependency == fileName {
+			index = i
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("%s does not import %s", this.GetName(), fileName)
+	}
+	this.Dependency = append(this.Dependency[:index], this.Dependency[index+1:]...)
+	removeLocations(this.FileDescriptorProto, Path{importPath, int32(index)})
+	this.PublicDependency = removeImportIndex(this.FileDescriptorProto, this.PublicDependency, publicImportPath, index)
+	this.WeakDependency = removeImportIndex(this.FileDescriptorProto, this.WeakDependency, weakImportPath, index)
+	return nil
+}
+
+// Removes the import with the given index from the list of indices of public
+// or weak imports, and moves the imports after it up by one.
+func removeImportIndex(file *FileDescriptorProto, indices []int32, tag int32, index int) []int32 {
+	var kept []int32
+	for i, dependency := range indices {
+		if int(dependency) == index {
+			removeLocations(file, Path{tag, int32(i)})
+			continue
+		}
+		if int(dependency) > index {
+			dependency -= 1
+		}
+		kept = append(kept, dependency)
+	}
+	return kept
+}
+
+// AddMessage adds a top-level message to the file.
+func (this *FileDescriptor) AddMessage(message *DescriptorProto) (*Descriptor, error) {
+	return addMessage(this.FileDescriptorProto, nil, &this.MessageType, message)
+}
+
+// RemoveMessage removes the top-level message with the given name, and
+// everything declared inside it.  The fields that refer to it are left as
+// they are.
+func (this *FileDescriptor) RemoveMessage(name string) error {
+	return removeMessage(this.FileDescriptorProto, nil, &this.MessageType, name)
+}
+
+// AddEnum adds a top-level enum to the file.
+func (this *FileDescriptor) AddEnum(enum *EnumDescriptorProto) (*EnumDescriptor, error) {
+	return addEnum(this.FileDescriptorProto, nil, &this.EnumType, enum)
+}
+
+// RemoveEnum removes the top-level enum with the given name.  The fields that
+// refer to it are left as they are.
+func (this *FileDescriptor) RemoveEnum(name string) error {
+	return removeEnum(this.FileDescriptorProto, nil, &this.EnumType, name)
+}
+
+// AddService adds a service to the file.  The input and output types of its
+// methods may be given relative to the package of the file.
+func (this *FileDescriptor) AddService(service *ServiceDescriptorProto) (*ServiceDescriptor, error) {
+	scope := packageScope(this.FileDescriptorProto)
+	if _, ok := symbols[scope+"."+service.GetName()]; ok {
+		return nil, fmt.Errorf("%s is already defined", strings.TrimPrefix(scope+"."+service.GetName(), "."))
+	}
+	var changes []func()
+	for _, method := range service.Method {
+		change, err := resolveMethodTypes(method, scope)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	for _, change := range changes {
+		change()
+	}
+	this.Service = append(this.Service, service)
+	buildSymbols(allFiles)
+	return newServiceDescriptor(service, this.FileDescriptorProto, len(this.Service)-1), nil
+}
+
+// RemoveService removes the service with the given name.
+func (this *FileDescriptor) RemoveService(name string) error {
+	for i, service := range this.Service {
+		if service.GetName() == name {
+			this.Service = append(this.Service[:i], this.Service[i+1:]...)
+			removeLocations(this.FileDescriptorProto, Path{servicePath, int32(i)})
+			buildSymbols(allFiles)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s has no service %s", this.GetName(), name)
+}
+
+// SetOption sets the file option with the given name, as it is written in an
+// option statement, to the value written as it is in a .proto file.  A
+// repeated option is left with just the value.
+func (this *FileDescriptor) SetOption(name string, value string) error {
+	return this.editOption(setOption, name, value)
+}
+
+// AddOption adds the value to the repeated file option with the given name.
+func (this *FileDescriptor) AddOption(name string, value string) error {
+	return this.editOption(addOption, name, value)
+}
+
+func (this *FileDescriptor) editOption(edit optionEditor, name string, value string) error {
+	if this.Options == nil {
+		this.Options = &FileOptions{}
+	}
+	return edit(this.Options, fileOptionsName, packageScope(this.FileDescriptorProto), name, value)
+}
+
+// AddField adds a field to the message.  The label defaults to optional.  The
+// type name of a message or enum field may be given relative to the message,
+// and the type itself is then found from it.
+func (this *Descriptor) AddField(field *FieldDescriptorProto) (*FieldDescriptor, error) {
+	path, err := this.pathOf()
+	if err != nil {
+		return nil, err
+	}
+	scope := this.fullName()
+	if _, ok := symbols[scope+"."+field.GetName()]; ok {
+		return nil, fmt.Errorf("%s is already defined", strings.TrimPrefix(scope+"."+field.GetName(), "."))
+	}
+	for _, other := range this.Field {
+		if other.GetNumber() == field.GetNumber() {
+			return nil, fmt.Errorf("field number %d of %s is already used by %s", field.GetNumber(), this.GetName(), other.GetName())
+		}
+	}
+	change, err := resolveFieldType(field, scope)
+	if err != nil {
+		return nil, err
+	}
+	change()
+
+	this.Field = append(this.Field, field)
+	buildSymbols(allFiles)
+	return &FieldDescriptor{this.common, field, this, path.child(messageFieldPath, len(this.Field)-1).String()}, nil
+}
+
+// RemoveField removes the field with the given name.  The message of a group
+// is removed along with it.
+func (this *Descriptor) RemoveField(name string) error {
+	path, err := this.pathOf()
+	if err != nil {
+		return err
+	}
+	for i, field := range this.Field {
+		if field.GetName() != name {
+			continue
+		}
+		this.Field = append(this.Field[:i], this.Field[i+1:]...)
+		removeLocations(this.file, path.child(messageFieldPath, i))
+		if field.GetType() == FieldDescriptorProto_TYPE_GROUP {
+			group := field.GetTypeName()[strings.LastIndex(field.GetTypeName(), ".")+1:]
+			return removeMessage(this.file, path, &this.NestedType, group)
+		}
+		buildSymbols(allFiles)
+		return nil
+	}
+	return fmt.Errorf("%s has no field %s", this.GetName(), name)
+}
+
+// AddMessage adds a nested message to the message.
+func (this *Descriptor) AddMessage(message *DescriptorProto) (*Descriptor, error) {
+	if _, err := this.pathOf(); err != nil {
+		return nil, err
+	}
+	return addMessage(this.file, this, &this.NestedType, message)
+}
+
+// RemoveMessage removes the nested message with the given name, and everything
+// declared inside it.  The fields that refer to it are left as they are.
+func (this *Descriptor) RemoveMessage(name string) error {
+	path, err := this.pathOf()
+	if err != nil {
+		return err
+	}
+	return removeMessage(this.file, path, &this.NestedType, name)
+}
+
+// AddEnum adds an enum to the message.
+func (this *Descriptor) AddEnum(enum *EnumDescriptorProto) (*EnumDescriptor, error) {
+	if _, err := this.pathOf(); err != nil {
+		return nil, err
+	}
+	return addEnum(this.file, this, &this.EnumType, enum)
+}
+
+// RemoveEnum removes the enum of the message with the given name.  The fields
+// that refer to it are left as they are.
+func (this *Descriptor) RemoveEnum(name string) error {
+	path, err := this.pathOf()
+	if err != nil {
+		return err
+	}
+	return removeEnum(this.file, path, &this.EnumType, name)
+}
+
+// Rename renames the message, and changes the fields and methods of every
+// file in the set that refer to it, or to the types inside it, along with it.
+func (this *Descriptor) Rename(name string) error {
+	if _, err := this.pathOf(); err != nil {
+		return err
+	}
+	if this.isGroup() {
+		return fmt.Errorf("%s is a group, which is named by its field", this.GetName())
+	}
+	oldName := this.fullName()
+	newName := oldName[:strings.LastIndex(oldName, ".")] + "." + name
+	if _, ok := symbols[newName]; ok {
+		return fmt.Errorf("%s is already defined", strings.TrimPrefix(newName, "."))
+	}
+	this.Name = proto.String(name)
+	renameReferences(oldName, newName)
+	buildSymbols(allFiles)
+	return nil
+}
+
+// SetOption sets the message option with the given name, as it is written in
+// an option statement, to the value written as it is in a .proto file.  A
+// repeated option is left with just the value.
+func (this *Descriptor) SetOption(name string, value string) error {
+	return this.editOption(setOption, name, value)
+}
+
+// AddOption adds the value to the repeated message option with the given name.
+func (this *Descriptor) AddOption(name string, value string) error {
+	return this.editOption(addOption, name, value)
+}
+
+func (this *Descriptor) editOption(edit optionEditor, name string, value string) error {
+	if _, err := this.pathOf(); err != nil {
+		return err
+	}
+	if this.Options == nil {
+		this.Options = &MessageOptions{}
+	}
+	return edit(this.Options, messageOptionsName, this.fullName(), name, value)
+}
+
+// RenameField changes the name of the field, and its JSON name along with it
+// unless the JSON name was set to another than the one of the old name.
+func RenameField(field *FieldDescriptorProto, name string) {
+	if field.GetJsonName() == defaultJsonName(field.GetName()) {
+		field.JsonName = nil
+	}
+	field.Name = proto.String(name)
+}
+
+// Rename renames the field.  Fields of groups cannot be renamed, their name
+// follows from the group.
+func (this *FieldDescriptor) Rename(name string) error {
+	if _, err := this.pathOf(); err != nil {
+		return err
+	}
+	if this.GetType() == FieldDescriptorProto_TYPE_GROUP {
+		return fmt.Errorf("%s is a group, which is named by its message", this.GetName())
+	}
+	newName := this.scope() + "." + name
+	if _, ok := symbols[newName]; ok {
+		return fmt.Errorf("%s is already defined", strings.TrimPrefix(newName, "."))
+	}
+	RenameField(this.FieldDescriptorProto, name)
+	buildSymbols(allFiles)
+	return nil
+}
+
+// SetOption sets the field option with the given name, as it is written in
+// the brackets after the field, to the value written as it is in a .proto
+// file.  A repeated option is left with just the value.
+func (this *FieldDescriptor) SetOption(name string, value string) error {
+	return this.editOption(setOption, name, value)
+}
+
+// AddOption adds the value to the repeated field option with the given name.
+func (this *FieldDescriptor) AddOption(name string, value string) error {
+	return this.editOption(addOption, name, value)
+}
+
+func (this *FieldDescriptor) editOption(edit optionEditor, name string, value string) error {
+	if _, err := this.pathOf(); err != nil {
+		return err
+	}
+	if this.Options == nil {
+		this.Options = &FieldOptions{}
+	}
+	return edit(this.Options, fieldOptionsName, this.scope(), name, value)
+}
+
+// Deprecate marks the field as deprecated.
+func (this *FieldDescriptor) Deprecate() error {
+	return this.SetOption("deprecated", "true")
+}
+
+// AddValue adds a value with the given name and number to the enum.
+func (this *EnumDescriptor) AddValue(name string, number int32) error {
+	if _, err := this.pathOf(); err != nil {
+		return err
+	}
+	// Enum values are siblings of their enum
+	if _, ok := symbols[this.scope()+"."+name]; ok {
+		return fmt.Errorf("%s is already defined", strings.TrimPrefix(this.scope()+"."+name, "."))
+	}
+	this.Value = append(this.Value, &EnumValueDescriptorProto{Name: proto.String(name), Number: proto.Int32(number)})
+	buildSymbols(allFiles)
+	return nil
+}
+
+// RemoveValue removes the value with the given name from the enum.
+func (this *EnumDescriptor) RemoveValue(name string) error {
+	path, err := this.pathOf()
+	if err != nil {
+		return err
+	}
+	index := this.valueIndex(name)
+	if index < 0 {
+		return fmt.Errorf("%s has no value %s", this.GetName(), name)
+	}
+	this.Value = append(this.Value[:index], this.Value[index+1:]...)
+	removeLocations(this.file, path.child(enumValuePath, index))
+	buildSymbols(allFiles)
+	return nil
+}
+
+// RenameValue renames a value of the enum, and the defaults of the fields of
+// every file in the set that are set to it.
+func (this *EnumDescriptor) RenameValue(name string, newName string) error {
+	if _, err := this.pathOf(); err != nil {
+		return err
+	}
+	index := this.valueIndex(name)
+	if index < 0 {
+		return fmt.Errorf("%s has no value %s", this.GetName(), name)
+	}
+	if _, ok := symbols[this.scope()+"."+newName]; ok {
+		return fmt.Errorf("%s is already defined", strings.TrimPrefix(this.scope()+"."+newName, "."))
+	}
+	this.Value[index].Name = proto.String(newName)
+	typeName := this.fullName()
+	for _, file := range allFiles {
+		forEachField(file.FileDescriptorProto, func(field *FieldDescriptorProto) {
+			if field.GetTypeName() == typeName && field.GetDefaultValue() == name {
+				field.DefaultValue = proto.String(newName)
+			}
+		})
+	}
+	buildSymbols(allFiles)
+	return nil
+}
+
+// SetValueOption sets the option with the given name of the value with the
+// given name, as the option is written in the brackets after the value, to the
+// option value written as it is in a .proto file.  A repeated option is left
+// with just the option value.
+func (this *EnumDescriptor) SetValueOption(valueName string, name string, value string) error {
+	return this.editValueOption(setOption, valueName, name, value)
+}
+
+// AddValueOption adds the option value to the repeated option with the given
+// name of the value with the given name.
+func (this *EnumDescriptor) AddValueOption(valueName string, name string, value string) error {
+	return this.editValueOption(addOption, valueName, name, value)
+}
+
+func (this *EnumDescriptor) editValueOption(edit optionEditor, valueName string, name string, value string) error {
+	if _, err := this.pathOf(); err != nil {
+		return err
+	}
+	index := this.valueIndex(valueName)
+	if index < 0 {
+		return fmt.Errorf("%s has no value %s", this.GetName(), valueName)
+	}
+	enumValue := this.Value[index]
+	if enumValue.Options == nil {
+		enumValue.Options = &EnumValueOptions{}
+	}
+	return edit(enumValue.Options, enumValueOptionsName, this.scope(), name, value)
+}
+
+// Rename renames the enum, and changes the fields of every file in the set
+// that refer to it along with it.
+func (this *EnumDescriptor) Rename(name string) error {
+	if _, err := this.pathOf(); err != nil {
+		return err
+	}
+	oldName := this.fullName()
+	newName := this.scope() + "." + name
+	if _, ok := symbols[newName]; ok {
+		return fmt.Errorf("%s is already defined", strings.TrimPrefix(newName, "."))
+	}
+	this.Name = proto.String(name)
+	renameReferences(oldName, newName)
+	buildSymbols(allFiles)
+	return nil
+}
+
+// SetOption sets the enum option with the given name, as it is written in an
+// option statement, to the value written as it is in a .proto file.  A
+// repeated option is left with just the value.
+func (this *EnumDescriptor) SetOption(name string, value string) error {
+	return this.editOption(setOption, name, value)
+}
+
+// AddOption adds the value to the repeated enum option with the given name.
+func (this *EnumDescriptor) AddOption(name string, value string) error {
+	return this.editOption(addOption, name, value)
+}
+
+func (this *EnumDescriptor) editOption(edit optionEditor, name string, value string) error {
+	if _, err := this.pathOf(); err != nil {
+		return err
+	}
+	if this.Options == nil {
+		this.Options = &EnumOptions{}
+	}
+	return edit(this.Options, enumOptionsName, this.scope(), name, value)
+}
+
+// AddMethod adds a method to the service.  Its input and output types may be
+// given relative to the package of the file.
+func (this *ServiceDescriptor) AddMethod(method *MethodDescriptorProto) error {
+	if _, err := this.pathOf(); err != nil {
+		return err
+	}
+	if this.methodIndex(method.GetName()) >= 0 {
+		return fmt.Errorf("%s already has a method %s", this.GetName(), method.GetName())
+	}
+	change, err := resolveMethodTypes(method, packageScope(this.file))
+	if err != nil {
+		return err
+	}
+	change()
+	this.Method = append(this.Method, method)
+	buildSymbols(allFiles)
+	return nil
+}
+
+// RemoveMethod removes the method with the given name from the service.
+func (this *ServiceDescriptor) RemoveMethod(name string) error {
+	path, err := this.pathOf()
+	if err != nil {
+		return err
+	}
+	index := this.methodIndex(name)
+	if index < 0 {
+		return fmt.Errorf("%s has no method %s", this.GetName(), name)
+	}
+	this.Method = append(this.Method[:index], this.Method[index+1:]...)
+	removeLocations(this.file, path.child(methodDescriptorPath, index))
+	buildSymbols(allFiles)
+	return nil
+}
+
+// RenameMethod renames a method of the service.
+func (this *ServiceDescriptor) RenameMethod(name string, newName string) error {
+	if _, err := this.pathOf(); err != nil {
+		return err
+	}
+	index := this.methodIndex(name)
+	if index < 0 {
+		return fmt.Errorf("%s has no method %s", this.GetName(), name)
+	}
+	if this.methodIndex(newName) >= 0 {
+		return fmt.Errorf("%s already has a method %s", this.GetName(), newName)
+	}
+	this.Method[index].Name = proto.String(newName)
+	buildSymbols(allFiles)
+	return nil
+}
+
+// SetMethodOption sets the option with the given name of the method with the
+// given name, as the option is written in an option statement, to the value
+// written as it is in a .proto file.  A repeated option is left with just the
+// value.
+func (this *ServiceDescriptor) SetMethodOption(method string, name string, value string) error {
+	return this.editMethodOption(setOption, method, name, value)
+}
+
+// AddMethodOption adds the value to the repeated option with the given name of
+// the method with the given name.
+func (this *ServiceDescriptor) AddMethodOption(method string, name string, value string) error {
+	return this.editMethodOption(addOption, method, name, value)
+}
+
+func (this *ServiceDescriptor) editMethodOption(edit optionEditor, method string, name string, value string) error {
+	if _, err := this.pathOf(); err != nil {
+		return err
+	}
+	index := this.methodIndex(method)
+	if index < 0 {
+		return fmt.Errorf("%s has no method %s", this.GetName(), method)
+	}
+	if this.Method[index].Options == nil {
+		this.Method[index].Options = &MethodOptions{}
+	}
+	return edit(this.Method[index].Options, methodOptionsName, this.fullName(), name, value)
+}
+
+// Rename renames the service.
+func (this *ServiceDescriptor) Rename(name string) error {
+	if _, err := this.pathOf(); err != nil {
+		return err
+	}
+	newName := packageScope(this.file) + "." + name
+	if _, ok := symbols[newName]; ok {
+		return fmt.Errorf("%s is already defined", strings.TrimPrefix(newName, "."))
+	}
+	this.Name = proto.String(name)
+	buildSymbols(allFiles)
+	return nil
+}
+
+// SetOption sets the service option with the given name, as it is written in
+// an option statement, to the value written as it is in a .proto file.  A
+// repeated option is left with just the value.
+func (this *ServiceDescriptor) SetOption(name string, value string) error {
+	return this.editOption(setOption, name, value)
+}
+
+// AddOption adds the value to the repeated service option with the given name.
+func (this *ServiceDescriptor) AddOption(name string, value string) error {
+	return this.editOption(addOption, name, value)
+}
+
+func (this *ServiceDescriptor) editOption(edit optionEditor, name string, value string) error {
+	if _, err := this.pathOf(); err != nil {
+		return err
+	}
+	if this.Options == nil {
+		this.Options = &ServiceOptions{}
+	}
+	return edit(this.Options, serviceOptionsName, packageScope(this.file), name, value)
+}
+
+// Returns the SourceCodeInfo path of the message, or an error if it was removed
+// from its file.
+func (this *Descriptor) pathOf() (Path, error) {
+	return elementPath(this.file, this.DescriptorProto, this.GetName())
+}
+
+// Returns the SourceCodeInfo path of the field, or an error if it was removed
+// from its file.
+func (this *FieldDescriptor) pathOf() (Path, error) {
+	return elementPath(this.file, this.FieldDescriptorProto, this.GetName())
+}
+
+// Returns the SourceCodeInfo path of the enum, or an error if it was removed
+// from its file.
+func (this *EnumDescriptor) pathOf() (Path, error) {
+	return elementPath(this.file, this.EnumDescriptorProto, this.GetName())
+}
+
+// Returns the SourceCodeInfo path of the service, or an error if it was
+// removed from its file.
+func (this *ServiceDescriptor) pathOf() (Path, error) {
+	return elementPath(this.file, this.ServiceDescriptorProto, this.GetName())
+}
+
+// The paths are looked up every time, as removing an element changes the
+// paths of the elements after it.
+func elementPath(file *FileDescriptorProto, element interface{}, name string) (Path, error) {
+	for i, service := range file.Service {
+		if service == element {
+			return Path{servicePath, int32(i)}, nil
+		}
+	}
+	path := pathInScope(nil, file.MessageType, file.EnumType, file.Extension, [3]int32{messagePath, enumPath, extendPath}, element)
+	if path == nil {
+		return nil, fmt.Errorf("%s is no longer in %s", name, file.GetName())
+	}
+	return path, nil
+}
+
+// Searches the messages, enums and extensions of a scope, with the given tags,
+// and everything inside the messages.
+func pathInScope(prefix Path, messages []*DescriptorProto, enums []*EnumDescriptorProto, extensions []*FieldDescriptorProto, tags [3]int32, element interface{}) Path {
+	for i, enum := range enums {
+		if enum == element {
+			return prefix.child(tags[1], i)
+		}
+	}
+	for i, extension := range extensions {
+		if extension == element {
+			return prefix.child(tags[2], i)
+		}
+	}
+	for i, message := range messages {
+		path := prefix.child(tags[0], i)
+		if message == element {
+			return path
+		}
+		for j, field := range message.Field {
+			if field == element {
+				return path.child(messageFieldPath, j)
+			}
+		}
+		if p := pathInScope(path, message.NestedType, message.EnumType, message.Extension, [3]int32{messageMessagePath, messageEnumPath, messageExtensionPath}, element); p != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+// removeLocations drops the locations of the element at the given path and of
+// everything inside it.  The elements after it in the same list move up by
+// one, and so do their locations, so that the comments stay with the elements
+// they belong to.
+func removeLocations(file *FileDescriptorProto, path Path) {
+	info := file.GetSourceCodeInfo()
+	if info == nil {
+		return
+	}
+	list := path[:len(path)-1]
+	index := path[len(path)-1]
+	var kept []*SourceCodeInfo_Location
+	for _, loc := range info.Location {
+		if Path(loc.Path).hasPrefix(path) {
+			continue
+		}
+		if len(loc.Path) > len(list) && Path(loc.Path).hasPrefix(list) && loc.Path[len(list)] > index {
+			loc.Path[len(list)] -= 1
+		}
+		kept = append(kept, loc)
+	}
+	info.Location = kept
+}
+
+func messageIndex(messages []*DescriptorProto, name string) int {
+	for i, message := range messages {
+		if message.GetName() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func enumIndex(enums []*EnumDescriptorProto, name string) int {
+	for i, enum := range enums {
+		if enum.GetName() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (this *EnumDescriptor) valueIndex(name string) int {
+	for i, value := range this.Value {
+		if value.GetName() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (this *ServiceDescriptor) methodIndex(name string) int {
+	for i, method := range this.Method {
+		if method.GetName() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Adds a message to the file, or to the parent message if there is one.  The
+// fields of the message, and of the messages inside it, may name their types
+// relative to the message.
+func addMessage(file *FileDescriptorProto, parent *Descriptor, messages *[]*DescriptorProto, message *DescriptorProto) (*Descriptor, error) {
+	scope := packageScope(file)
+	if parent != nil {
+		scope = parent.fullName()
+	}
+	if _, ok := symbols[scope+"."+message.GetName()]; ok {
+		return nil, fmt.Errorf("%s is already defined", strings.TrimPrefix(scope+"."+message.GetName(), "."))
+	}
+
+	*messages = append(*messages, message)
+	buildSymbols(allFiles)
+	changes, err := resolveMessageTypes(message, scope+"."+message.GetName())
+	if err != nil {
+		*messages = (*messages)[:len(*messages)-1]
+		buildSymbols(allFiles)
+		return nil, err
+	}
+	for _, change := range changes {
+		change()
+	}
+	return newDescriptor(message, parent, file, len(*messages)-1), nil
+}
+
+// Resolves the types of the fields of the message and of its nested messages,
+// and returns the changes that fill them in.
+func resolveMessageTypes(message *DescriptorProto, scope string) ([]func(), error) {
+	var changes []func()
+	for _, field := range message.Field {
+		change, err := resolveFieldType(field, scope)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	for _, nested := range message.NestedType {
+		nestedChanges, err := resolveMessageTypes(nested, scope+"."+nested.GetName())
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, nestedChanges...)
+	}
+	return changes, nil
+}
+
+// Removes the message with the given name from the file, or from the message
+// at the given path.
+func removeMessage(file *FileDescriptorProto, path Path, messages *[]*DescriptorProto, name string) error {
+	index := messageIndex(*messages, name)
+	if index < 0 {
+		return fmt.Errorf("%s has no message %s", scopeName(file, path), name)
+	}
+	*messages = append((*messages)[:index], (*messages)[index+1:]...)
+	if path == nil {
+		removeLocations(file, Path{messagePath, int32(index)})
+	} else {
+		removeLocations(file, path.child(messageMessagePath, index))
+	}
+	buildSymbols(allFiles)
+	return nil
+}
+
+// Adds an enum to the file, or to the parent message if there is one.
+func addEnum(file *FileDescriptorProto, parent *Descriptor, enums *[]*EnumDescriptorProto, enum *EnumDescriptorProto) (*EnumDescriptor, error) {
+	scope := packageScope(file)
+	if parent != nil {
+		scope = parent.fullName()
+	}
+	names := []string{enum.GetName()}
+	for _, value := range enum.Value {
+		names = append(names, value.GetName())
+	}
+	for _, name := range names {
+		if _, ok := symbols[scope+"."+name]; ok {
+			return nil, fmt.Errorf("%s is already defined", strings.TrimPrefix(scope+"."+name, "."))
+		}
+	}
+	*enums = append(*enums, enum)
+	buildSymbols(allFiles)
+	return newEnumDescriptor(enum, parent, file, len(*enums)-1), nil
+}
+
+// Removes the enum with the given name from the file, or from the message at
+// the given path.
+func removeEnum(file *FileDescriptorProto, path Path, enums *[]*EnumDescriptorProto, name string) error {
+	index := enumIndex(*enums, name)
+	if index < 0 {
+		return fmt.Errorf("%s has no enum %s", scopeName(file, path), name)
+	}
+	*enums = append((*enums)[:index], (*enums)[index+1:]...)
+	if path == nil {
+		removeLocations(file, Path{enumPath, int32(index)})
+	} else {
+		removeLocations(file, path.child(messageEnumPath, index))
+	}
+	buildSymbols(allFiles)
+	return nil
+}
+
+// Returns the name of the file, or of the message at the given path, for
+// errors.
+func scopeName(file *FileDescriptorProto, path Path) string {
+	name := file.GetName()
+	messages := file.MessageType
+	for i := 1; i < len(path); i += 2 {
+		message := messages[path[i]]
+		name, messages = message.GetName(), message.NestedType
+	}
+	return name
+}
+
+// Resolves the type name of a message or enum field from the given scope, and
+// returns the change that fills it in, along with the type and label of the
+// field if they are not given.  The field itself is left alone, so that
+// nothing changes when another field of the same edit does not resolve.
+func resolveFieldType(field *FieldDescriptorProto, scope string) (func(), error) {
+	if field.Type != nil && field.GetType() == FieldDescriptorProto_TYPE_GROUP {
+		return nil, fmt.Errorf("field %s: groups cannot be added", field.GetName())
+	}
+	setLabel := func() {
+		if field.Label == nil {
+			field.Label = FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+		}
+	}
+	if field.Type != nil && !field.IsMessage() && !field.IsEnum() {
+		return setLabel, nil
+	}
+	typeName := resolveName(field.GetTypeName(), scope)
+	if len(typeName) == 0 {
+		return nil, fmt.Errorf("field %s: unknown type %s", field.GetName(), field.GetTypeName())
+	}
+	kind := symbols[typeName].kind
+	fieldType := field.Type
+	switch {
+	case field.Type == nil && kind == messageSymbol:
+		fieldType = FieldDescriptorProto_TYPE_MESSAGE.Enum()
+	case field.Type == nil:
+		fieldType = FieldDescriptorProto_TYPE_ENUM.Enum()
+	case field.IsMessage() != (kind == messageSymbol):
+		return nil, fmt.Errorf("field %s: %s is not of type %s", field.GetName(), field.GetTypeName(), field.GetType())
+	}
+	return func() {
+		setLabel()
+		field.Type = fieldType
+		field.TypeName = proto.String(typeName)
+	}, nil
+}
+
+// Resolves the input and output types of a method from the given scope, and
+// returns the change that fills them in.
+func resolveMethodTypes(method *MethodDescriptorProto, scope string) (func(), error) {
+	var resolved []string
+	for _, typeName := range []*string{method.InputType, method.OutputType} {
+		if typeName == nil {
+			return nil, fmt.Errorf("method %s: missing input or output type", method.GetName())
+		}
+		name := resolveName(*typeName, scope)
+		if len(name) == 0 || symbols[name].kind != messageSymbol {
+			return nil, fmt.Errorf("method %s: unknown message type %s", method.GetName(), *typeName)
+		}
+		resolved = append(resolved, name)
+	}
+	return func() {
+		method.InputType = proto.String(resolved[0])
+		method.OutputType = proto.String(resolved[1])
+	}, nil
+}
+
+// Returns whether the message is the message of a group field.
+func (this *Descriptor) isGroup() bool {
+	fields := [][]*FieldDescriptorProto{this.file.Extension}
+	if this.parent != nil {
+		fields = [][]*FieldDescriptorProto{this.parent.Field, this.parent.Extension}
+	}
+	for _, list := range fields {
+		for _, field := range list {
+			if field.GetType() == FieldDescriptorProto_TYPE_GROUP && field.GetTypeName() == this.fullName() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Changes every reference to the type with the old fully-qualified name, or to
+// a type inside it, in all the files of the set.
+func renameReferences(oldName string, newName string) {
+	rename := func(name *string) {
+		if name == nil {
+			return
+		}
+		if *name == oldName || strings.HasPrefix(*name, oldName+".") {
+			*name = newName + (*name)[len(oldName):]
+		}
+	}
+	for _, file := range allFiles {
+		forEachField(file.FileDescriptorProto, func(field *FieldDescriptorProto) {
+			rename(field.TypeName)
+			rename(field.Extendee)
+		})
+		for _, service := range file.Service {
+			for _, method := range service.Method {
+				rename(method.InputType)
+				rename(method.OutputType)
+			}
+		}
+	}
+}
+
+// Calls fn for every field and extension in the file.
+func forEachField(file *FileDescriptorProto, fn func(field *FieldDescriptorProto)) {
+	var walk func(messages []*DescriptorProto)
+	walk = func(messages []*DescriptorProto) {
+		for _, message := range messages {
+			for _, field := range message.Field {
+				fn(field)
+			}
+			for _, extension := range message.Extension {
+				fn(extension)
+			}
+			walk(message.NestedType)
+		}
+	}
+	for _, extension := range file.Extension {
+		fn(extension)
+	}
+	walk(file.MessageType)
+}
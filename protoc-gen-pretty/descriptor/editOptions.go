@@ -0,0 +1,411 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package descriptor
+
+import (
+	proto "code.google.com/p/gogoprotobuf/proto"
+	binary "encoding/binary"
+	fmt "fmt"
+	math "math"
+	reflect "reflect"
+	strconv "strconv"
+	strings "strings"
+	utf8 "unicode/utf8"
+)
+
+// setOption sets the option with the given name in the options message, which
+// extends the given options type.  The name is written as in an option
+// statement: built-in options by their own name and custom options between
+// parentheses, relative to scope.  The value is written as in a .proto file.
+// Setting a repeated custom option replaces all of its values with the one
+// value, addOption adds one instead.  Custom options of message types cannot
+// be set.
+func setOption(options proto.Message, extendee string, scope string, name string, value string) error {
+	if !strings.HasPrefix(name, "(") {
+		return setBuiltinOption(options, name, value)
+	}
+	ext, b, err := encodeCustomOption(extendee, scope, name, value)
+	if err != nil {
+		return err
+	}
+	options.(extendableOptions).ExtensionMap()[ext.field.GetNumber()] = proto.NewExtension(b)
+	return nil
+}
+
+// addOption adds the value after the values the repeated custom option with
+// the given name already has.  The name and value are written as for
+// setOption.
+func addOption(options proto.Message, extendee string, scope string, name string, value string) error {
+	if !strings.HasPrefix(name, "(") {
+		return fmt.Errorf("option %s is not repeated", name)
+	}
+	ext, b, err := encodeCustomOption(extendee, scope, name, value)
+	if err != nil {
+		return err
+	}
+	if !ext.field.IsRepeated() {
+		return fmt.Errorf("option %s is not repeated", name)
+	}
+	extensionMap := options.(extendableOptions).ExtensionMap()
+	if raw, err := proto.GetRawExtension(extensionMap, ext.field.GetNumber()); err == nil {
+		b = append(raw, b...)
+	}
+	extensionMap[ext.field.GetNumber()] = proto.NewExtension(b)
+	return nil
+}
+
+// optionEditor is either setOption or addOption.
+type optionEditor func(options proto.Message, extendee string, scope string, name string, value string) error
+
+// encodeCustomOption returns the extension of the custom option with the given
+// name and the wire format of the value of one of its elements.
+func encodeCustomOption(extendee string, scope string, name string, value string) (*symbol, []byte, error) {
+	if !strings.HasSuffix(name, ")") {
+		return nil, nil, fmt.Errorf("option %s: fields of options cannot be set one by one", name)
+	}
+	ext := findOption(strings.TrimSuffix(strings.TrimPrefix(name, "("), ")"), extendee, scope)
+	if ext == nil {
+		return nil, nil, fmt.Errorf("unknown option %s", name)
+	}
+	b, err := encodeOptionValue(ext.field, value)
+	if err != nil {
+		return nil, nil, fmt.Errorf("option %s: %v", name, err)
+	}
+	return ext, b, nil
+}
+
+// The options messages keep their custom options in an extension map.
+type extendableOptions interface {
+	ExtensionMap() map[int32]proto.Extension
+}
+
+// findOption returns the extension of the options type with the given name,
+// looked up from scope and then from each enclosing scope in turn.
+func findOption(name string, extendee string, scope string) *symbol {
+	if strings.HasPrefix(name, ".") {
+		scope, name = "", name[1:]
+	}
+	for {
+		if ext := lookupSymbol(scope+"."+name, extensionSymbol); ext != nil && ext.field.GetExtendee() == extendee {
+			return ext
+		}
+		if len(scope) == 0 {
+			return nil
+		}
+		scope = scope[:strings.LastIndex(scope, ".")]
+	}
+}
+
+// setBuiltinOption sets a field of the options message, which is found through
+// its protobuf tag like decodeBuiltinOptions does.
+func setBuiltinOption(options proto.Message, name string, value string) error {
+	v := reflect.ValueOf(options).Elem()
+	for i, prop := range proto.GetProperties(v.Type()).Prop {
+		f := v.Field(i)
+		if prop.OrigName != name || prop.Tag == 0 || hiddenOptions[name] || f.Kind() != reflect.Ptr {
+			continue
+		}
+		elem := reflect.New(f.Type().Elem())
+		var err error
+		switch {
+		case len(prop.Enum) > 0:
+			n, ok := proto.EnumValueMap(prop.Enum)[value]
+			if !ok {
+				return fmt.Errorf("option %s: unknown value %s", name, value)
+			}
+			elem.Elem().SetInt(int64(n))
+		case elem.Elem().Kind() == reflect.Bool:
+			var b bool
+			b, err = parseBool(value)
+			elem.Elem().SetBool(b)
+		case elem.Elem().Kind() == reflect.String:
+			var s string
+			s, err = unquote(value)
+			elem.Elem().SetString(s)
+		default:
+			return fmt.Errorf("option %s cannot be set", name)
+		}
+		if err != nil {
+			return fmt.Errorf("option %s: %v", name, err)
+		}
+		f.Set(elem)
+		return nil
+	}
+	return fmt.Errorf("unknown option %s", name)
+}
+
+// encodeOptionValue returns the wire format of the value of a custom option.
+func encodeOptionValue(field *FieldDescriptorProto, value string) ([]byte, error) {
+	var b []byte
+	switch field.GetType() {
+	case FieldDescriptorProto_TYPE_BOOL:
+		v, err := parseBool(value)
+		if err != nil {
+			return nil, err
+		}
+		if v {
+			b = proto.EncodeVarint(1)
+		} else {
+			b = proto.EncodeVarint(0)
+		}
+	case FieldDescriptorProto_TYPE_INT32, FieldDescriptorProto_TYPE_INT64:
+		v, err := parseInt(value, bitSize(field))
+		if err != nil {
+			return nil, err
+		}
+		b = proto.EncodeVarint(uint64(v))
+	case FieldDescriptorProto_TYPE_UINT32, FieldDescriptorProto_TYPE_UINT64:
+		v, err := parseUint(value, bitSize(field))
+		if err != nil {
+			return nil, err
+		}
+		b = proto.EncodeVarint(v)
+	case FieldDescriptorProto_TYPE_SINT32, FieldDescriptorProto_TYPE_SINT64:
+		v, err := parseInt(value, bitSize(field))
+		if err != nil {
+			return nil, err
+		}
+		b = proto.EncodeVarint(uint64(v<<1) ^ uint64(v>>63))
+	case FieldDescriptorProto_TYPE_FIXED32, FieldDescriptorProto_TYPE_FIXED64:
+		v, err := parseUint(value, bitSize(field))
+		if err != nil {
+			return nil, err
+		}
+		b = fixed(field, v)
+	case FieldDescriptorProto_TYPE_SFIXED32, FieldDescriptorProto_TYPE_SFIXED64:
+		v, err := parseInt(value, bitSize(field))
+		if err != nil {
+			return nil, err
+		}
+		b = fixed(field, uint64(v))
+	case FieldDescriptorProto_TYPE_FLOAT:
+		v, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return nil, err
+		}
+		b = fixed(field, uint64(math.Float32bits(float32(v))))
+	case FieldDescriptorProto_TYPE_DOUBLE:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, err
+		}
+		b = fixed(field, math.Float64bits(v))
+	case FieldDescriptorProto_TYPE_STRING, FieldDescriptorProto_TYPE_BYTES:
+		v, err := unquote(value)
+		if err != nil {
+			return nil, err
+		}
+		b = append(proto.EncodeVarint(uint64(len(v))), v...)
+	case FieldDescriptorProto_TYPE_ENUM:
+		n, ok := enumValueNumber(field.GetTypeName(), value)
+		if !ok {
+			return nil, fmt.Errorf("unknown value %s", value)
+		}
+		b = proto.EncodeVarint(uint64(n))
+	default:
+		return nil, fmt.Errorf("options of type %s cannot be set", field.GetType())
+	}
+	key := proto.EncodeVarint(uint64(field.GetNumber())<<3 | uint64(field.WireType()))
+	return append(key, b...), nil
+}
+
+func bitSize(field *FieldDescriptorProto) int {
+	if field.WireType() == 5 {
+		return 32
+	}
+	switch field.GetType() {
+	case FieldDescriptorProto_TYPE_INT32, FieldDescriptorProto_TYPE_UINT32, FieldDescriptorProto_TYPE_SINT32:
+		return 32
+	}
+	return 64
+}
+
+// Returns the value in the little-endian byte order of fixed-size fields.
+func fixed(field *FieldDescriptorProto, v uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	return b[:bitSize(field)/8]
+}
+
+// Returns the number of the value with the given name in the enum with the
+// given fully-qualified type name.
+func enumValueNumber(typeName string, name string) (int32, bool) {
+	if sym := lookupSymbol(typeName, enumSymbol); sym != nil {
+		for _, enumValue := range sym.enum.GetValue() {
+			if enumValue.GetName() == name {
+				return enumValue.GetNumber(), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func parseBool(value string) (bool, error) {
+	switch value {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("%s is not true or false", value)
+}
+
+// parseInt parses an integer as it is written in a .proto file: in decimal,
+// in hexadecimal after 0x, or in octal after a leading 0, with an optional
+// minus sign.
+func parseInt(value string, bitSize int) (int64, error) {
+	digits, base, err := integerDigits(strings.TrimPrefix(value, "-"))
+	if err != nil {
+		return 0, err
+	}
+	if strings.HasPrefix(value, "-") {
+		digits = "-" + digits
+	}
+	return strconv.ParseInt(digits, base, bitSize)
+}
+
+// parseUint parses an unsigned integer written like for parseInt.
+func parseUint(value string, bitSize int) (uint64, error) {
+	digits, base, err := integerDigits(value)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(digits, base, bitSize)
+}
+
+// Returns the digits of an integer without its sign and their base.
+func integerDigits(value string) (string, int, error) {
+	digits, base := value, 10
+	switch {
+	case strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X"):
+		digits, base = value[2:], 16
+	case len(value) > 1 && value[0] == '0':
+		digits, base = value[1:], 8
+	}
+	if len(digits) == 0 {
+		return "", 0, fmt.Errorf("%s is not an integer", value)
+	}
+	for i := range digits {
+		if !isDigit(digits[i], base) {
+			return "", 0, fmt.Errorf("%s is not an integer", value)
+		}
+	}
+	return digits, base, nil
+}
+
+func isDigit(c byte, base int) bool {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c-'0') < base
+	case c >= 'a' && c <= 'f', c >= 'A' && c <= 'F':
+		return base == 16
+	}
+	return false
+}
+
+// unquote returns the content of a string literal in single or double quotes,
+// with the escapes of the protobuf language: \n and the other C escapes, octal
+// escapes of one to three digits, hexadecimal escapes of one or two digits
+// after \x, and \u and \U escapes of Unicode code points.
+func unquote(value string) (string, error) {
+	if len(value) < 2 || (value[0] != '"' && value[0] != '\'') || value[len(value)-1] != value[0] {
+		return "", fmt.Errorf("%s is not a quoted string", value)
+	}
+	quote := value[0]
+	s := value[1 : len(value)-1]
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == quote || c == '\n' {
+			return "", fmt.Errorf("%s is not a valid string", value)
+		}
+		if c != '\\' {
+			b = append(b, c)
+			continue
+		}
+		i += 1
+		if i == len(s) {
+			return "", fmt.Errorf("%s ends in an escape", value)
+		}
+		switch c = s[i]; c {
+		case 'a':
+			b = append(b, '\a')
+		case 'b':
+			b = append(b, '\b')
+		case 'f':
+			b = append(b, '\f')
+		case 'n':
+			b = append(b, '\n')
+		case 'r':
+			b = append(b, '\r')
+		case 't':
+			b = append(b, '\t')
+		case 'v':
+			b = append(b, '\v')
+		case '\\', '?', '\'', '"':
+			b = append(b, c)
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			n, end := escapeNumber(s, i, 3, 8)
+			if n > 255 {
+				return "", fmt.Errorf("%s has an octal escape above \\377", value)
+			}
+			b = append(b, byte(n))
+			i = end - 1
+		case 'x', 'X':
+			n, end := escapeNumber(s, i+1, 2, 16)
+			if end == i+1 {
+				return "", fmt.Errorf("%s has \\x without hexadecimal digits", value)
+			}
+			b = append(b, byte(n))
+			i = end - 1
+		case 'u', 'U':
+			size := 4
+			if c == 'U' {
+				size = 8
+			}
+			n, end := escapeNumber(s, i+1, size, 16)
+			if end != i+1+size || !utf8.ValidRune(rune(n)) {
+				return "", fmt.Errorf("%s has an invalid \\%c escape", value, c)
+			}
+			b = append(b, string(rune(n))...)
+			i = end - 1
+		default:
+			return "", fmt.Errorf("%s has an unknown escape \\%c", value, c)
+		}
+	}
+	return string(b), nil
+}
+
+// Reads at most max digits in the base from s, starting at start, and returns
+// their value and the index after the last one.
+func escapeNumber(s string, start int, max int, base int) (uint64, int) {
+	end := start
+	for end < len(s) && end-start < max && isDigit(s[end], base) {
+		end += 1
+	}
+	n, _ := strconv.ParseUint(s[start:end], base, 64)
+	return n, end
+}
@@ -26,16 +26,17 @@ OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 package descriptor
 
 import (
-	"bytes"
 	proto "code.google.com/p/gogoprotobuf/proto"
 	"encoding/binary"
 	fmt "fmt"
-	regex "regexp"
+	math "math"
+	path "path"
 	sort "sort"
 	strings "strings"
 )
 
 const (
+	// The indentation of the default style
 	INDENT = "  "
 )
 
@@ -47,15 +48,25 @@ var commentsMap map[string]*SourceCodeInfo_Location
 
 // Handles the set of Files (but for provided filename only)
 func (this *FileDescriptorSet) Fmt(fileToFormat string) string {
+	return this.FmtStyle(fileToFormat, DefaultStyle())
+}
+
+// Formats the provided filename of the set in the given style
+func (this *FileDescriptorSet) FmtStyle(fileToFormat string, style *Style) string {
+	currentStyle = style
+
 	// Loop through all the FileDescriptorProto
 	allFiles = make([]*FileDescriptor, len(this.File))
 	WrapTypes(this)
+	buildSymbols(allFiles)
+	warnings = nil
 	for _, tmpFile := range allFiles {
 		if tmpFile.GetName() == fileToFormat {
 			thisFile = tmpFile
 			s := tmpFile.Fmt(0)
 			//fmt.Println(tmpFile.GoString())
-			s = strings.Replace(s, "\n\n\n", "\n\n", -1)
+			s = collapseBlankLines(s)
+			s = alignCells(s)
 			return s
 		}
 	}
@@ -68,6 +79,8 @@ func (this *FileDescriptor) Fmt(depth int) string {
 		return "nil"
 	}
 	currentFile = *this
+	warnDetachedComments()
+	warnUnrecognizedFields()
 
 	var s []string
 
@@ -85,26 +98,39 @@ func (this *FileDescriptor) Fmt(depth int) string {
 	}
 	// For each import
 	if len(this.GetDependency()) > 0 && counter > 0 {
-		s = append(s, "\n")
+		s = append(s, sectionBreak())
 	}
 	if len(this.GetDependency()) > 0 {
 		importsList = make([]string, len(this.GetDependency()))
-		i := 0
 
-		sort.Strings(this.GetDependency())
+		// Sort the imports, the comments stay with the original index
+		sorted := make([]string, len(this.GetDependency()))
+		copy(sorted, this.GetDependency())
+		sort.Strings(sorted)
+		index := make(map[string]int)
 		for ind, imp := range this.GetDependency() {
+			index[imp] = ind
+		}
+
+		for i, imp := range sorted {
+			ind := index[imp]
 			importsList[i] = strings.Split(imp, "/")[len(strings.Split(imp, "/"))-1]
-			i += 1
+
+			if i > 0 && currentStyle.ImportGrouping == ImportGroupingDirectory && path.Dir(imp) != path.Dir(sorted[i-1]) {
+				s = append(s, "\n")
+			}
 
 			lc := LeadingComments(fmt.Sprintf("%d,%d", importPath, ind), depth)
 			if len(lc) > 0 {
-				if ind == 0 {
+				if i == 0 {
 					s = append(s, strings.TrimPrefix(lc, "\n"))
 				} else {
 					s = append(s, lc)
 				}
 			}
-			s = append(s, `import "`)
+			s = append(s, `import `)
+			s = append(s, importModifier(this.FileDescriptorProto, ind))
+			s = append(s, `"`)
 			s = append(s, imp)
 			s = append(s, `";`)
 			s = append(s, "\n")
@@ -114,202 +140,18 @@ func (this *FileDescriptor) Fmt(depth int) string {
 		counter += 1
 	}
 
-	// Special options
+	// Built-in options
 	options := this.GetOptions()
-	optionCount := 0
-	var optSlice []string
-	if options != nil {
-		if (len(this.GetOptions().GetJavaPackage()) > 0 ||
-			len(this.GetOptions().GetJavaOuterClassname()) != 0 ||
-			this.GetOptions().GetJavaMultipleFiles() ||
-			this.GetOptions().GetJavaGenerateEqualsAndHash() ||
-			int32(*this.GetOptions().GetOptimizeFor().Enum()) > 1) && counter > 0 {
-			s = append(s, "\n")
-		}
-
-		// JAVA PACKAGE
-		if len(this.GetOptions().GetJavaPackage()) != 0 {
-			var singOpt []string
-			lc := LeadingComments(fmt.Sprintf("%d,999,%d", optionsPath, optionCount), depth)
-			if len(lc) > 0 {
-				if optionCount == 0 {
-					singOpt = append(singOpt, strings.TrimPrefix(lc, "\n"))
-				} else {
-					singOpt = append(singOpt, lc)
-				}
-			}
-			singOpt = append(singOpt, "option java_package = ")
-			singOpt = append(singOpt, `"`+this.GetOptions().GetJavaPackage()+`"`)
-			singOpt = append(singOpt, ";\n")
-			singOpt = append(singOpt, TrailingComments(fmt.Sprintf("%d,999,%d", optionsPath, optionCount), depth))
-			optionCount += 1
-
-			optSlice = append(optSlice, strings.Join(singOpt, ""))
-		}
-
-		// JAVA OUTER CLASSNAME
-		if len(this.GetOptions().GetJavaOuterClassname()) != 0 {
-			var singOpt []string
-			lc := LeadingComments(fmt.Sprintf("%d,999,%d", optionsPath, optionCount), depth)
-			if len(lc) > 0 {
-				if optionCount == 0 {
-					singOpt = append(singOpt, strings.TrimPrefix(lc, "\n"))
-				} else {
-					singOpt = append(singOpt, lc)
-				}
-			}
-			singOpt = append(singOpt, "option java_outer_classname = ")
-			singOpt = append(singOpt, `"`+this.GetOptions().GetJavaOuterClassname()+`"`)
-			singOpt = append(singOpt, ";\n")
-			singOpt = append(singOpt, TrailingComments(fmt.Sprintf("%d,999,%d", optionsPath, optionCount), depth))
-			optionCount += 1
-			optSlice = append(optSlice, strings.Join(singOpt, ""))
-		}
-
-		// JAVA MULTIPLE FILES
-		if this.GetOptions().GetJavaMultipleFiles() {
-			var singOpt []string
-			lc := LeadingComments(fmt.Sprintf("%d,999,%d", optionsPath, optionCount), depth)
-			if len(lc) > 0 {
-				if optionCount == 0 {
-					singOpt = append(singOpt, strings.TrimPrefix(lc, "\n"))
-				} else {
-					singOpt = append(singOpt, lc)
-				}
-			}
-			singOpt = append(singOpt, "option java_multiple_files = true")
-			singOpt = append(singOpt, ";\n")
-			singOpt = append(singOpt, TrailingComments(fmt.Sprintf("%d,999,%d", optionsPath, optionCount), depth))
-			optionCount += 1
-			optSlice = append(optSlice, strings.Join(singOpt, ""))
-		}
-
-		// JAVA GENERATE EQUALS AND HASH
-		if this.GetOptions().GetJavaGenerateEqualsAndHash() {
-			var singOpt []string
-			lc := LeadingComments(fmt.Sprintf("%d,999,%d", optionsPath, optionCount), depth)
-			if len(lc) > 0 {
-				if optionCount == 0 {
-					singOpt = append(singOpt, strings.TrimPrefix(lc, "\n"))
-				} else {
-					singOpt = append(singOpt, lc)
-				}
-			}
-			singOpt = append(singOpt, "option java_generate_equals_and_hash = true")
-			singOpt = append(singOpt, ";\n")
-			singOpt = append(singOpt, TrailingComments(fmt.Sprintf("%d,999,%d", optionsPath, optionCount), depth))
-			optionCount += 1
-			optSlice = append(optSlice, strings.Join(singOpt, ""))
-		}
-
-		// GO PACKAGE
-		if len(this.GetOptions().GetGoPackage()) > 0 {
-			var singOpt []string
-			lc := LeadingComments(fmt.Sprintf("%d,999,%d", optionsPath, optionCount), depth)
-			if len(lc) > 0 {
-				if optionCount == 0 {
-					singOpt = append(singOpt, strings.TrimPrefix(lc, "\n"))
-				} else {
-					singOpt = append(singOpt, lc)
-				}
-			}
-			singOpt = append(singOpt, `option go_package = "`)
-			singOpt = append(singOpt, this.GetOptions().GetGoPackage())
-			singOpt = append(singOpt, `";`)
-			singOpt = append(singOpt, "\n")
-			singOpt = append(singOpt, TrailingComments(fmt.Sprintf("%d,999,%d", optionsPath, optionCount), depth))
-			optionCount += 1
-			optSlice = append(optSlice, strings.Join(singOpt, ""))
-		}
-
-		//CC GENERIC SERVICE
-		if this.GetOptions().GetCcGenericServices() {
-			var singOpt []string
-			lc := LeadingComments(fmt.Sprintf("%d,999,%d", optionsPath, optionCount), depth)
-			if len(lc) > 0 {
-				if optionCount == 0 {
-					singOpt = append(singOpt, strings.TrimPrefix(lc, "\n"))
-				} else {
-					singOpt = append(singOpt, lc)
-				}
-			}
-			singOpt = append(singOpt, "option cc_generic_services = true")
-			singOpt = append(singOpt, ";\n")
-			singOpt = append(singOpt, TrailingComments(fmt.Sprintf("%d,999,%d", optionsPath, optionCount), depth))
-			optionCount += 1
-			optSlice = append(optSlice, strings.Join(singOpt, ""))
-		}
-
-		//JAVA GENERIC SERVICE
-		if this.GetOptions().GetJavaGenericServices() {
-			var singOpt []string
-			lc := LeadingComments(fmt.Sprintf("%d,999,%d", optionsPath, optionCount), depth)
-			if len(lc) > 0 {
-				if optionCount == 0 {
-					singOpt = append(singOpt, strings.TrimPrefix(lc, "\n"))
-				} else {
-					singOpt = append(singOpt, lc)
-				}
-			}
-			singOpt = append(singOpt, "option java_generic_services = true")
-			singOpt = append(singOpt, ";\n")
-			singOpt = append(singOpt, TrailingComments(fmt.Sprintf("%d,999,%d", optionsPath, optionCount), depth))
-			optionCount += 1
-			optSlice = append(optSlice, strings.Join(singOpt, ""))
-		}
-
-		// PY GENERIC SERVICE
-		if this.GetOptions().GetPyGenericServices() {
-			var singOpt []string
-			lc := LeadingComments(fmt.Sprintf("%d,999,%d", optionsPath, optionCount), depth)
-			if len(lc) > 0 {
-				if optionCount == 0 {
-					singOpt = append(singOpt, strings.TrimPrefix(lc, "\n"))
-				} else {
-					singOpt = append(singOpt, lc)
-				}
-			}
-			singOpt = append(singOpt, "option py_generic_services = true")
-			singOpt = append(singOpt, ";\n")
-			singOpt = append(singOpt, TrailingComments(fmt.Sprintf("%d,999,%d", optionsPath, optionCount), depth))
-			optionCount += 1
-			optSlice = append(optSlice, strings.Join(singOpt, ""))
-		}
-
-		//OPTIMIZE FOR
-		if this.GetOptions().OptimizeFor != nil {
-			var singOpt []string
-			lc := LeadingComments(fmt.Sprintf("%d,999,%d", optionsPath, optionCount), depth)
-			if len(lc) > 0 {
-				if optionCount == 0 {
-					singOpt = append(singOpt, strings.TrimPrefix(lc, "\n"))
-				} else {
-					singOpt = append(singOpt, lc)
-				}
-			}
-			singOpt = append(singOpt, "option optimize_for = ")
-			if int32(*this.GetOptions().GetOptimizeFor().Enum()) > 1 {
-				singOpt = append(singOpt, this.GetOptions().GetOptimizeFor().String())
-			} else {
-				singOpt = append(singOpt, "SPEED")
-			}
-			singOpt = append(singOpt, ";\n")
-			singOpt = append(singOpt, TrailingComments(fmt.Sprintf("%d,999,%d", optionsPath, optionCount), depth))
-
-			optSlice = append(optSlice, strings.Join(singOpt, ""))
-		}
-	}
-	if len(optSlice) > 0 {
-		s = append(s, strings.Join(sortSpecialOptions(optSlice), ""))
+	builtinOptions := getFormattedBuiltinOptions(options, -1, false, fmt.Sprintf("%d", optionsPath))
+	if len(builtinOptions) > 0 && counter > 0 {
+		s = append(s, sectionBreak())
 	}
+	s = append(s, strings.Join(builtinOptions, ""))
 
 	// File Options
-	if options != nil && len(options.ExtensionMap()) > 0 {
-		s = append(s, "\n")
-		theOption := getFormattedOptionsFromExtensionMap(options.ExtensionMap(), -1, false, fmt.Sprintf("%d", optionsPath), optionCount)
-
-		theOption = sortOptions(theOption)
-
+	if options != nil && (len(options.ExtensionMap()) > 0 || len(options.GetUninterpretedOption()) > 0) {
+		s = append(s, sectionBreak())
+		theOption := getFormattedOptionsFromExtensionMap(options.ExtensionMap(), options.GetUninterpretedOption(), fileOptionsName, -1, false, fmt.Sprintf("%d", optionsPath), len(builtinOptions))
 		s = append(s, strings.Join(theOption, ""))
 
 		counter += 1
@@ -317,25 +159,35 @@ func (this *FileDescriptor) Fmt(depth int) string {
 
 	// For each extend
 	extendGroups := make(map[string]string)
-	for i, ext := range this.ext {
+	var extendees []string
+	for _, ext := range this.ext {
+		if _, ok := extendGroups[ext.GetExtendee()]; !ok {
+			extendees = append(extendees, ext.GetExtendee())
+			extendGroups[ext.GetExtendee()] = ""
+		}
+	}
+	for _, i := range printOrder(len(this.ext), func(a, b int) bool { return this.ext[a].GetNumber() < this.ext[b].GetNumber() }) {
+		ext := this.ext[i]
 		extendGroups[ext.GetExtendee()] = extendGroups[ext.GetExtendee()] + LeadingComments(fmt.Sprintf("%d,%d", extendPath, i), depth+1) + ext.Fmt(depth+1) + ";\n" + TrailingComments(fmt.Sprintf("%d,%d", extendPath, i), depth+1)
 
 	}
 	if len(extendGroups) > 0 && counter > 0 {
-		s = append(s, "\n")
+		s = append(s, sectionBreak())
 	}
-	ind := 0
-	for i := range extendGroups {
+	for k, ind := range printOrder(len(extendees), func(a, b int) bool { return extendees[a] < extendees[b] }) {
+		i := extendees[ind]
 		group := extendGroups[i]
+		if k > 0 {
+			s = append(s, "\n")
+		}
 		if ind == 0 {
 			s = append(s, strings.TrimPrefix(LeadingComments(fmt.Sprintf("%d", extendPath), depth), "\n"))
 		} else {
-			s = append(s, "\n")
 			s = append(s, LeadingComments(fmt.Sprintf("%d,%d", extendPath, ind*1000), depth))
 		}
 		s = append(s, getIndentation(depth))
 		s = append(s, `extend `)
-		s = append(s, strings.Replace(i, ".", "", 1))
+		s = append(s, typeNameInScope(i, packageScope(this.FileDescriptorProto)))
 		s = append(s, " {\n")
 		s = append(s, group)
 		s = append(s, getIndentation(depth))
@@ -347,40 +199,45 @@ func (this *FileDescriptor) Fmt(depth int) string {
 			s = append(s, TrailingComments(fmt.Sprintf("%d,%d", extendPath, ind*1000), depth))
 		}
 
-		ind += 1
 		counter += 1
 	}
 
 	// Enums
 	if len(this.enum) > 0 && counter > 0 {
-		s = append(s, "\n")
+		s = append(s, sectionBreak())
 	}
-	for _, enum := range this.enum {
-		s = append(s, enum.Fmt(depth))
-		s = append(s, "\n")
+	for k, i := range printOrder(len(this.enum), func(a, b int) bool { return this.enum[a].GetName() < this.enum[b].GetName() }) {
+		if k > 0 {
+			s = append(s, sectionBreak())
+		}
+		s = append(s, this.enum[i].Fmt(depth))
 
 		counter += 1
 	}
 
 	// Messages
 	if counter > 0 && len(this.desc) > 0 {
-		s = append(s, "\n")
+		s = append(s, sectionBreak())
 	}
-	for _, message := range this.desc {
-		if message.parent == nil {
+	for _, i := range printOrder(len(this.desc), func(a, b int) bool { return this.desc[a].GetName() < this.desc[b].GetName() }) {
+		if message := this.desc[i]; message.parent == nil {
 			s = append(s, message.Fmt(depth, false, nil))
-			s = append(s, "\n")
+			s = append(s, sectionBreak())
 
 			counter += 1
 		}
 	}
 
-	// Services
+	// Services, the messages already end in a section break
 	if len(this.serv) > 0 && counter > 0 {
-		s = append(s, "\n")
+		if len(this.desc) > 0 {
+			s = append(s, "\n")
+		} else {
+			s = append(s, sectionBreak())
+		}
 	}
-	for _, service := range this.serv {
-		s = append(s, service.Fmt(depth))
+	for _, i := range printOrder(len(this.serv), func(a, b int) bool { return this.serv[a].GetName() < this.serv[b].GetName() }) {
+		s = append(s, this.serv[i].Fmt(depth))
 		s = append(s, "\n")
 
 		counter += 1
@@ -428,29 +285,31 @@ func (this *Descriptor) Fmt(depth int, isGroup bool, groupField *FieldDescriptor
 		contentCount += 1
 	}
 	extendGroups := make(map[string]string)
-	for index, ext := range this.ext {
-		if depth == 0 {
-			extendGroups[ext.GetExtendee()] = extendGroups[ext.GetExtendee()] + LeadingComments(fmt.Sprintf("%s,%d,%d", this.path, messageExtensionPath, index), depth+2) + getIndentation(depth+1) + ext.Fmt(depth+1) + ";\n" + TrailingComments(fmt.Sprintf("%s,%d,%d", this.path, messageExtensionPath, index), depth+2)
-		} else {
-			extendGroups[ext.GetExtendee()] = extendGroups[ext.GetExtendee()] + LeadingComments(fmt.Sprintf("%s,%d,%d", this.path, messageExtensionPath, index), depth+2) + ext.Fmt(depth+1) + ";\n" + TrailingComments(fmt.Sprintf("%s,%d,%d", this.path, messageExtensionPath, index), depth+2)
+	var extendees []string
+	for _, ext := range this.ext {
+		if _, ok := extendGroups[ext.GetExtendee()]; !ok {
+			extendees = append(extendees, ext.GetExtendee())
+			extendGroups[ext.GetExtendee()] = ""
 		}
-
 	}
-	index := 0
-	for i := range extendGroups {
+	for _, index := range printOrder(len(this.ext), func(a, b int) bool { return this.ext[a].GetNumber() < this.ext[b].GetNumber() }) {
+		ext := this.ext[index]
+		extendGroups[ext.GetExtendee()] = extendGroups[ext.GetExtendee()] + LeadingComments(fmt.Sprintf("%s,%d,%d", this.path, messageExtensionPath, index), depth+2) + ext.Fmt(depth+2) + ";\n" + TrailingComments(fmt.Sprintf("%s,%d,%d", this.path, messageExtensionPath, index), depth+2)
+	}
+	for k, index := range printOrder(len(extendees), func(a, b int) bool { return extendees[a] < extendees[b] }) {
+		i := extendees[index]
 		group := extendGroups[i]
+		if k > 0 {
+			s = append(s, "\n")
+		}
 		if index == 0 {
 			s = append(s, LeadingComments(fmt.Sprintf("%s,%d", this.path, messageExtensionPath), depth+1))
 		} else {
-			s = append(s, "\n")
 			s = append(s, LeadingComments(fmt.Sprintf("%s,%d,%d", this.path, messageExtensionPath, index*1000), depth+1))
 		}
 		s = append(s, getIndentation(depth+1))
 		s = append(s, `extend `)
-		if strings.HasPrefix(i, ".") {
-			i = i[1:]
-		}
-		s = append(s, i)
+		s = append(s, typeNameInScope(i, this.fullName()))
 		s = append(s, " {\n")
 		if index == 0 {
 			tc := TrailingComments(fmt.Sprintf("%s,%d", this.path, messageExtensionPath), depth+1)
@@ -471,19 +330,20 @@ func (this *Descriptor) Fmt(depth int, isGroup bool, groupField *FieldDescriptor
 		s = append(s, group)
 		s = append(s, getIndentation(depth+1))
 		s = append(s, "}\n")
-
-		index += 1
 	}
 
 	// Options
 	mesOptions := this.GetOptions()
-	if mesOptions != nil && len(mesOptions.ExtensionMap()) > 0 {
+	builtinOptions := getFormattedBuiltinOptions(mesOptions, depth, false, fmt.Sprintf("%s,%d", this.path, messageOptionsPath))
+	if len(builtinOptions) > 0 || (mesOptions != nil && (len(mesOptions.ExtensionMap()) > 0 || len(mesOptions.GetUninterpretedOption()) > 0)) {
 		s = append(s, "\n")
 		contentCount += 1
 
-		opts := getFormattedOptionsFromExtensionMap(mesOptions.ExtensionMap(), depth, false, fmt.Sprintf("%d,%d", this.path, messageOptionsPath), 0)
-		opts = sortOptions(opts)
-		s = append(s, strings.Join(opts, ""))
+		s = append(s, strings.Join(builtinOptions, ""))
+		if mesOptions != nil {
+			opts := getFormattedOptionsFromExtensionMap(mesOptions.ExtensionMap(), mesOptions.GetUninterpretedOption(), messageOptionsName, depth, false, fmt.Sprintf("%s,%d", this.path, messageOptionsPath), len(builtinOptions))
+			s = append(s, strings.Join(opts, ""))
+		}
 	}
 
 	// Fields
@@ -491,7 +351,14 @@ func (this *Descriptor) Fmt(depth int, isGroup bool, groupField *FieldDescriptor
 		s = append(s, "\n")
 		contentCount += 1
 	}
-	for i, field := range this.field {
+	order := printOrder(len(this.field), func(a, b int) bool { return this.field[a].GetNumber() < this.field[b].GetNumber() })
+	for k, i := range order {
+		field := this.field[i]
+		// Groups are always set apart, and sorted fields only keep the blank
+		// lines between fields that were next to each other
+		if k > 0 && order[k-1] == i-1 && field.GetType() != FieldDescriptorProto_TYPE_GROUP && blankLineBetween(fmt.Sprintf("%s,%d,%d", this.path, messageFieldPath, i-1), fmt.Sprintf("%s,%d,%d", this.path, messageFieldPath, i)) {
+			s = append(s, "\n")
+		}
 
 		if field.GetType() == FieldDescriptorProto_TYPE_GROUP {
 			for i := 0; i < len(nestedMessages); i += 1 {
@@ -507,18 +374,19 @@ func (this *Descriptor) Fmt(depth int, isGroup bool, groupField *FieldDescriptor
 		} else {
 			lc := LeadingComments(fmt.Sprintf("%s,%d,%d", this.path, messageFieldPath, i), depth+1)
 			if len(lc) > 0 {
-				if i == 0 {
+				if k == 0 {
 					s = append(s, strings.TrimPrefix(lc, "\n"))
 				} else {
 					s = append(s, lc)
 				}
 			}
 
-			s = append(s, field.Fmt(depth+1))
+			declaration := field.Fmt(depth + 1)
+			s = append(s, declaration)
 			s = append(s, ";")
 			tc := TrailingComments(fmt.Sprintf("%s,%d,%d", this.path, messageFieldPath, i), depth+1)
 			if len(tc) > 0 {
-				s = append(s, tc)
+				s = append(s, alignedTrailingComment(declaration, tc))
 			} else {
 				s = append(s, "\n")
 			}
@@ -586,131 +454,31 @@ func (this *FieldDescriptor) Fmt(depth int) string {
 	s = append(s, ` `)
 	// If referencing a message
 	if *this.Type == FieldDescriptorProto_TYPE_MESSAGE || *this.Type == FieldDescriptorProto_TYPE_ENUM {
-		var found bool
-		typeName := getLastWordFromPath(this.GetTypeName(), ".")
-		for _, mes := range currentFile.GetMessageType() {
-			if mes.GetName() == typeName {
-				found = true
-			}
-		}
-		if this.parent != nil {
-			// Maybe in other another message
-			for _, mes := range this.parent.DescriptorProto.GetNestedType() {
-				if b, str := scanNestedMessages(mes, typeName, ""); b {
-					typeName = str
-					found = true
-					break
-				}
-			}
-			// Maybe in other enums
-			if !found {
-				for _, mes := range this.parent.enum {
-					if strcmp(mes.GetName(), typeName) == 0 {
-						found = true
-						break
-					}
-				}
-			}
-			// Maybe same package
-			if !found {
-				for _, curFile := range allFiles {
-					// Same Package
-					if strcmp(curFile.GetPackage(), currentFile.GetPackage()) == 0 {
-						// Look in messages
-						for _, mes := range curFile.GetMessageType() {
-							if b, str := scanNestedMessages(mes, typeName, ""); b {
-								typeName = str
-								found = true
-								break
-							}
-						}
-						if !found {
-							// Look in enums
-							for _, enum := range curFile.GetEnumType() {
-								if strcmp(enum.GetName(), typeName) == 0 {
-									found = true
-									break
-								}
-							}
-						}
-					}
-				}
-			}
-		}
-		if found {
-			s = append(s, typeName)
-		} else {
-			typeName = this.GetTypeName()
-			if strings.HasPrefix(typeName, ".") {
-				typeName = typeName[1:]
-			}
-			s = append(s, typeName)
-		}
-
+		s = append(s, typeNameInScope(this.GetTypeName(), this.scope()))
 	} else {
 		s = append(s, fieldDescriptorProtoType_StringValue(*this.Type))
 	}
-	s = append(s, ` `)
+	s = append(s, cellBreak())
 	s = append(s, this.GetName())
-	s = append(s, ` = `)
+	s = append(s, cellBreak())
+	s = append(s, `= `)
 	s = append(s, fmt.Sprintf("%v", this.GetNumber()))
 
 	// OPTIONS
-
-	options := this.GetOptions()
-	i := 0
-	if options != nil || len(this.GetDefaultValue()) > 0 {
-		s = append(s, ` [`)
+	var opts []string
+	if this.DefaultValue != nil && !(currentStyle.Simplify && redundantDefault(this.FieldDescriptorProto)) {
+		opts = append(opts, `default`+optionEquals(false)+formatDefaultValue(this.FieldDescriptorProto))
 	}
-
-	if len(this.GetDefaultValue()) > 0 {
-		s = append(s, `default=`)
-		s = append(s, this.GetDefaultValue())
-		i += 1
+	if this.JsonName != nil && this.GetJsonName() != defaultJsonName(this.GetName()) {
+		opts = append(opts, `json_name`+optionEquals(false)+quoteBytes([]byte(this.GetJsonName()), true))
 	}
-	if options != nil {
-		if options.GetPacked() || options.GetLazy() || options.GetDeprecated() || len(options.ExtensionMap()) > 0 {
-
-			if len(options.ExtensionMap()) > 0 {
-				if i >= 1 {
-					s = append(s, ", ")
-				} else {
-					i += 1
-				}
-				opts := getFormattedOptionsFromExtensionMap(options.ExtensionMap(), -1, true, "", 0)
-				s = append(s, strings.Join(opts, ""))
-			}
-
-			if options.GetPacked() {
-				if i >= 1 {
-					s = append(s, ", ")
-				}
-				s = append(s, `packed=true`)
-				i += 1
-			}
-
-			if options.GetLazy() {
-				if i >= 1 {
-					s = append(s, ", ")
-				}
-				s = append(s, `lazy=true`)
-				i += 1
-			}
-
-			if options.GetDeprecated() {
-				if i >= 1 {
-					s = append(s, ", ")
-				}
-				s = append(s, `deprecated=true`)
-				i += 1
-			}
-		}
-		if i == 0 {
-			s = append(s, `deprecated=false`)
-		}
+	if options := this.GetOptions(); options != nil {
+		fieldPath := fmt.Sprintf("%s,%d", this.path, fieldOptionsPath)
+		opts = append(opts, getFormattedOptionsFromExtensionMap(options.ExtensionMap(), options.GetUninterpretedOption(), fieldOptionsName, -1, true, fieldPath, 0)...)
+		opts = append(opts, getFormattedBuiltinOptions(options, -1, true, fieldPath)...)
 	}
-	if options != nil || len(this.GetDefaultValue()) > 0 {
-		s = append(s, `]`)
+	if len(opts) > 0 {
+		s = append(s, formatOptionList(strings.Join(s, ""), opts, depth))
 	}
 
 	return strings.Join(s, "")
@@ -739,56 +507,73 @@ func (this *EnumDescriptor) Fmt(depth int) string {
 
 	// Options
 	options := this.GetOptions()
-	if options != nil && len(options.ExtensionMap()) > 0 {
+	builtinOptions := getFormattedBuiltinOptions(options, depth, false, fmt.Sprintf("%s,%d", this.path, enumOptionsPath))
+	if len(builtinOptions) > 0 || (options != nil && (len(options.ExtensionMap()) > 0 || len(options.GetUninterpretedOption()) > 0)) {
 		s = append(s, "\n")
 
-		opts := getFormattedOptionsFromExtensionMap(options.ExtensionMap(), depth, false, fmt.Sprintf("%d,%d", this.path, enumOptionsPath), 0)
-		opts = sortOptions(opts)
-		s = append(s, strings.Join(opts, ""))
+		s = append(s, strings.Join(builtinOptions, ""))
+		if options != nil {
+			opts := getFormattedOptionsFromExtensionMap(options.ExtensionMap(), options.GetUninterpretedOption(), enumOptionsName, depth, false, fmt.Sprintf("%s,%d", this.path, enumOptionsPath), len(builtinOptions))
+			s = append(s, strings.Join(opts, ""))
+		}
 	}
 
 	// enum fields
 	if len(this.GetValue()) > 0 {
 		s = append(s, "\n")
 	}
-	for i, enumValue := range this.GetValue() {
+	values := this.GetValue()
+	order := printOrder(len(values), func(a, b int) bool { return values[a].GetNumber() < values[b].GetNumber() })
+	for k, i := range order {
+		enumValue := values[i]
+		if k > 0 && order[k-1] == i-1 && blankLineBetween(fmt.Sprintf("%s,%d,%d", this.path, enumValuePath, i-1), fmt.Sprintf("%s,%d,%d", this.path, enumValuePath, i)) {
+			s = append(s, "\n")
+		}
 
 		// Comments of the enum fields
 		lc := LeadingComments(fmt.Sprintf("%s,%d,%d", this.path, enumValuePath, i), depth+1)
 		if len(lc) > 0 {
-			if i == 0 {
+			if k == 0 {
 				s = append(s, strings.TrimPrefix(lc, "\n"))
 			} else {
 				s = append(s, lc)
 			}
 		}
 
+		declarationStart := len(s)
 		s = append(s, getIndentation(depth+1))
 		s = append(s, enumValue.GetName())
 
-		s = append(s, ` = `)
+		s = append(s, cellBreak())
+		s = append(s, `= `)
 		s = append(s, fmt.Sprintf("%v", enumValue.GetNumber()))
 
 		// OPTIONS
 		valueOptions := enumValue.GetOptions()
 		if valueOptions != nil {
-			s = append(s, ` [`)
-			opts := getFormattedOptionsFromExtensionMap(valueOptions.ExtensionMap(), -1, true, fmt.Sprintf("%d,%d", this.path, enumValueOptionsPath), 0)
-			s = append(s, strings.Join(opts, ""))
-			s = append(s, `]`)
+			valuePath := fmt.Sprintf("%s,%d,%d,%d", this.path, enumValuePath, i, enumValueOptionsPath)
+			opts := getFormattedOptionsFromExtensionMap(valueOptions.ExtensionMap(), valueOptions.GetUninterpretedOption(), enumValueOptionsName, -1, true, valuePath, 0)
+			opts = append(opts, getFormattedBuiltinOptions(valueOptions, -1, true, valuePath)...)
+			if len(opts) > 0 {
+				s = append(s, formatOptionList(strings.Join(s[declarationStart:], ""), opts, depth+1))
+			}
 		}
 
 		s = append(s, ";")
 		tc := TrailingComments(fmt.Sprintf("%s,%d,%d", this.path, enumValuePath, i), 0)
 		if len(tc) > 0 {
-			s = append(s, " "+tc)
+			s = append(s, alignedTrailingComment(strings.Join(s[declarationStart:], ""), " "+tc))
 		} else {
 			s = append(s, "\n")
 		}
 	}
 
 	s = append(s, getIndentation(depth))
-	s = append(s, "};\n")
+	if currentStyle.EnumSemicolon {
+		s = append(s, "};\n")
+	} else {
+		s = append(s, "}\n")
+	}
 
 	return strings.Join(s, "")
 }
@@ -835,9 +620,10 @@ func (this *ServiceDescriptor) Fmt(depth int) string {
 
 	// Service Options
 	options := this.GetOptions()
+	builtinOptions := getFormattedBuiltinOptions(options, depth, false, fmt.Sprintf("%s,%d", this.path, serviceOptionsPath))
+	s = append(s, strings.Join(builtinOptions, ""))
 	if options != nil {
-		opts := getFormattedOptionsFromExtensionMap(options.ExtensionMap(), depth, false, fmt.Sprintf("%s,%d", this.path, serviceOptionsPath), 0)
-		opts = sortOptions(opts)
+		opts := getFormattedOptionsFromExtensionMap(options.ExtensionMap(), options.GetUninterpretedOption(), serviceOptionsName, depth, false, fmt.Sprintf("%s,%d", this.path, serviceOptionsPath), len(builtinOptions))
 		s = append(s, strings.Join(opts, ""))
 	}
 
@@ -846,6 +632,9 @@ func (this *ServiceDescriptor) Fmt(depth int) string {
 		s = append(s, "\n")
 	}
 	for i, method := range this.GetMethod() {
+		if i > 0 && blankLineBetween(fmt.Sprintf("%s,%d,%d", this.path, methodDescriptorPath, i-1), fmt.Sprintf("%s,%d,%d", this.path, methodDescriptorPath, i)) {
+			s = append(s, "\n")
+		}
 		lc := LeadingComments(fmt.Sprintf("%s,%d,%d", this.path, methodDescriptorPath, i), depth+1)
 		if len(lc) > 0 {
 			if i == 0 {
@@ -854,27 +643,34 @@ func (this *ServiceDescriptor) Fmt(depth int) string {
 				s = append(s, lc)
 			}
 		}
-		s = append(s, getIndentation(depth+1))
-		s = append(s, `rpc `)
-		s = append(s, method.GetName())
-		s = append(s, `(`)
+		signature := getIndentation(depth+1) + `rpc ` + method.GetName() + `(`
 		if len(method.GetInputType()) > 0 {
-			s = append(s, getLastWordFromPath(method.GetInputType(), "."))
+			signature += typeNameInScope(method.GetInputType(), this.fullName())
 		}
-		s = append(s, `)`)
+		signature += `)`
 		if len(method.GetOutputType()) > 0 {
-			s = append(s, ` returns(`)
-			s = append(s, getLastWordFromPath(method.GetOutputType(), "."))
-			s = append(s, `)`)
+			returns := `returns(` + typeNameInScope(method.GetOutputType(), this.fullName()) + `)`
+			if fitsLine(signature + " " + returns + " {") {
+				signature += " " + returns
+			} else {
+				// Continued lines are indented twice
+				signature += "\n" + getIndentation(depth+3) + returns
+			}
 		}
+		s = append(s, signature)
 		s = append(s, " {\n")
 		tc := TrailingComments(fmt.Sprintf("%s,%d,%d", this.path, methodDescriptorPath, i), depth+2)
 		if len(tc) > 0 {
 			s = append(s, tc)
 			s = append(s, "\n")
 		}
-		opts := getFormattedOptionsFromExtensionMap(method.GetOptions().ExtensionMap(), depth+1, false, fmt.Sprintf("%s,%d,%d,%d", this.path, methodDescriptorPath, i, methodOptionsPath), 0)
-		s = append(s, strings.Join(opts[1:], ""))
+		methodPath := fmt.Sprintf("%s,%d,%d,%d", this.path, methodDescriptorPath, i, methodOptionsPath)
+		builtinOptions := getFormattedBuiltinOptions(method.GetOptions(), depth+1, false, methodPath)
+		s = append(s, strings.Join(builtinOptions, ""))
+		if method.GetOptions() != nil {
+			opts := getFormattedOptionsFromExtensionMap(method.GetOptions().ExtensionMap(), method.GetOptions().GetUninterpretedOption(), methodOptionsName, depth+1, false, methodPath, len(builtinOptions))
+			s = append(s, strings.Join(opts, ""))
+		}
 
 		s = append(s, getIndentation(depth+1))
 		s = append(s, "}\n")
@@ -886,225 +682,228 @@ func (this *ServiceDescriptor) Fmt(depth int) string {
 	return strings.Join(s, "")
 }
 
-func getFormattedOptionsFromExtensionMap(extensionMap map[int32]proto.Extension, depth int, fieldOption bool, pathIncludingParent string, startIndex int) []string {
+func getFormattedOptionsFromExtensionMap(extensionMap map[int32]proto.Extension, uninterpreted []*UninterpretedOption, extendee string, depth int, fieldOption bool, pathIncludingParent string, startIndex int) []string {
 	var s []string
-	counter := 0
-	if len(extensionMap) > 0 {
-		commentsIndex := startIndex
-		// Sort extension map
-		for optInd := range extensionMap {
-			// Loop through all imported files
-			for _, curFile := range allFiles {
-				extensions := curFile.GetExtension()
-
-				// Loop through extensions in the FileDescriptorProto
-				for ext_i, ext := range extensions {
-					if ext.GetNumber() == optInd {
-						bytes, _ := proto.GetRawExtension(extensionMap, optInd)
-						key, n := proto.DecodeVarint(bytes)
-						headerlength := n
-
-						wt := key & 0x7
-
-						var val string
-
-						var singleOption []string
-
-						// Enums are special
-						if ext.GetType() == FieldDescriptorProto_TYPE_ENUM {
-							// Loop through enums to find right one
-							for _, myEnum := range curFile.GetEnumType() {
-								if myEnum.GetName() == getLastWordFromPath(ext.GetTypeName(), ".") {
-									for _, enumVal := range myEnum.GetValue() {
-										d, _ := proto.DecodeVarint(bytes[n:])
-
-										if uint64(enumVal.GetNumber()) == d {
-											val = enumVal.GetName()
-										}
-									}
-								}
-							}
-
-							lc := LeadingComments(fmt.Sprintf("%s,%d,%d", pathIncludingParent, 999, commentsIndex), depth+1)
-							if len(lc) > 0 {
-								if ext_i == 0 {
-									singleOption = append(singleOption, strings.TrimPrefix(lc, "\n"))
-								} else {
-									singleOption = append(singleOption, lc)
-								}
-							}
-							if !fieldOption {
-								singleOption = append(singleOption, getIndentation(depth+1))
-								singleOption = append(singleOption, `option (`)
-							} else {
-								if counter >= 1 {
-									singleOption = append(singleOption, ", ")
-								}
-								singleOption = append(singleOption, `(`)
-							}
-
-							if curFile.GetName() != currentFile.GetName() && len(curFile.GetPackage()) > 0 {
-
-								singleOption = append(singleOption, curFile.GetPackage())
-								singleOption = append(singleOption, ".")
-							}
-							singleOption = append(singleOption, ext.GetName())
-							singleOption = append(singleOption, ")=")
-							singleOption = append(singleOption, val)
-
-							if !fieldOption {
-								singleOption = append(singleOption, ";\n")
-							}
-							comm := TrailingComments(fmt.Sprintf("%s,%d,%d", pathIncludingParent, 999, commentsIndex), depth+1)
-							if len(comm) > 0 {
-								singleOption = append(singleOption, comm)
-								if counter < len(extensionMap)-1 {
-									singleOption = append(singleOption, "\n")
-								}
-							}
-							s = append(s, strings.Join(singleOption, ""))
-
-							commentsIndex += 1
-							counter += 1
-
-						} else if wt == 2 && ext.GetType() != FieldDescriptorProto_TYPE_STRING { // Messages are special (for method options)
-
-							for n < len(bytes) {
-								// Grab the payload
-								_, m := proto.DecodeVarint(bytes[n:])
-								n += m
-								// Grab tag/wiretype
-								//fmt.Printf("%v, %v\n", n, len(bytes))
-								firstInt, a := proto.DecodeVarint(bytes[n:])
-								//fmt.Printf("firstint: %v\n", a)
-								n += a
-								wiretype := firstInt & 0x7
-								var packType FieldDescriptorProto_Type
-								switch wiretype {
-								case 0:
-									packType = FieldDescriptorProto_TYPE_INT32
-
-								case 1:
-									packType = FieldDescriptorProto_TYPE_FIXED64
-
-								case 2:
-									packType = FieldDescriptorProto_TYPE_STRING
-
-								case 5:
-									packType = FieldDescriptorProto_TYPE_FIXED32
-								}
-
-								packVal, b := byteToValueString(bytes, n, packType)
-								n = b
-								//fmt.Printf("%v\n", packType)
-								//fmt.Printf("%v\n", packVal)
-								n += headerlength
-
-								if ext.GetType() == FieldDescriptorProto_TYPE_MESSAGE {
-									tagNum := firstInt >> 3
-									//fmt.Printf("tagnum: %v\n", tagNum)
-
-									// Loop through messages to find right one
-									myMessage := curFile.GetMessage(getLastWordFromPath(ext.GetTypeName(), "."))
-									//fmt.Println(myMessage.GetName())
-									for _, field := range myMessage.GetField() {
-										if uint64(field.GetNumber()) == tagNum {
-											val = `.` + field.GetName() + " = " + packVal
-											break
-										}
-									}
-								}
-
-								singleOption = append(singleOption, LeadingComments(fmt.Sprintf("%s,%d,%d", pathIncludingParent, 999, commentsIndex), depth+1))
-
-								if !fieldOption {
-									singleOption = append(singleOption, getIndentation(depth+1))
-									singleOption = append(singleOption, `option (`)
-								} else {
-									if counter >= 1 {
-										singleOption = append(singleOption, ", ")
-									}
-									singleOption = append(singleOption, `(`)
-								}
-
-								if curFile.GetName() != currentFile.GetName() && len(curFile.GetPackage()) > 0 {
-									singleOption = append(singleOption, curFile.GetPackage())
-									singleOption = append(singleOption, ".")
-								}
-								singleOption = append(singleOption, ext.GetName())
-								singleOption = append(singleOption, ")")
-								singleOption = append(singleOption, val)
-								if !fieldOption {
-									singleOption = append(singleOption, ";\n")
-								}
-								comm := TrailingComments(fmt.Sprintf("%s,%d,%d", pathIncludingParent, 999, commentsIndex), depth+1)
-								if len(comm) > 0 {
-									singleOption = append(singleOption, comm)
-									if counter < len(extensionMap) {
-										singleOption = append(singleOption, "\n")
-									}
-								}
-								commentsIndex += 1
-								counter += 1
-
-								s = append(s, strings.Join(singleOption, ""))
-
-							}
-
-						} else {
-							val, b := byteToValueString(bytes, n, ext.GetType())
-							n = b
-
-							singleOption = append(singleOption, LeadingComments(fmt.Sprintf("%s,%d,%d", pathIncludingParent, 999, commentsIndex), depth+1))
-
-							if !fieldOption {
-								singleOption = append(singleOption, getIndentation(depth+1))
-								singleOption = append(singleOption, `option (`)
-							} else {
-								if counter >= 1 {
-									singleOption = append(singleOption, ", ")
-								}
-								singleOption = append(singleOption, `(`)
-							}
-
-							if curFile.GetName() != currentFile.GetName() && len(curFile.GetPackage()) > 0 {
-								singleOption = append(singleOption, curFile.GetPackage())
-								singleOption = append(singleOption, ".")
-							}
-							singleOption = append(singleOption, ext.GetName())
-							singleOption = append(singleOption, ")=")
-							singleOption = append(singleOption, val)
-
-							if !fieldOption {
-								singleOption = append(singleOption, ";\n")
-							}
-							comm := TrailingComments(fmt.Sprintf("%s,%d,%d", pathIncludingParent, 999, commentsIndex), depth+1)
-							if len(comm) > 0 {
-								singleOption = append(singleOption, comm)
-								if counter < len(extensionMap) {
-									singleOption = append(singleOption, "\n")
-								}
-							}
-							commentsIndex += 1
-							counter += 1
-
-							s = append(s, strings.Join(singleOption, ""))
-						}
-
-					}
+	opts := decodeExtensionMap(extensionMap, extendee, pathIncludingParent)
+	opts = append(opts, decodeUninterpretedOptions(uninterpreted, pathIncludingParent)...)
+
+	for i, opt := range opts {
+		var singleOption []string
+
+		// Options decoded by a recent protoc carry the interpreted path,
+		// older versions only know the index of the uninterpreted option.
+		commentPath := opt.path
+		if _, ok := currentFile.comments[commentPath]; !ok {
+			commentPath = fmt.Sprintf("%s,%d,%d", pathIncludingParent, 999, startIndex+opt.index)
+		}
+
+		if !fieldOption {
+			singleOption = append(singleOption, LeadingComments(commentPath, depth+1))
+			singleOption = append(singleOption, getIndentation(depth+1))
+			singleOption = append(singleOption, `option `)
+		}
+		singleOption = append(singleOption, opt.name)
+		if len(opt.subPath) > 0 {
+			singleOption = append(singleOption, opt.subPath)
+			singleOption = append(singleOption, optionEquals(true))
+		} else {
+			singleOption = append(singleOption, optionEquals(false))
+		}
+		singleOption = append(singleOption, opt.value)
+
+		if !fieldOption {
+			singleOption = append(singleOption, ";\n")
+			comm := TrailingComments(commentPath, depth+1)
+			if len(comm) > 0 {
+				singleOption = append(singleOption, comm)
+				if i < len(opts)-1 {
+					singleOption = append(singleOption, "\n")
 				}
 			}
 		}
+
+		s = append(s, strings.Join(singleOption, ""))
 	}
 
 	return s
 }
 
+// Formats the options declared by descriptor.proto itself
+func getFormattedBuiltinOptions(options proto.Message, depth int, fieldOption bool, pathIncludingParent string) []string {
+	var s []string
+	opts := decodeBuiltinOptions(options, pathIncludingParent)
+	if !fieldOption {
+		sortOptionValues(opts)
+	}
+
+	for i, opt := range opts {
+		redundant := currentStyle.Simplify && redundantOption(opt.name, opt.value)
+		if fieldOption {
+			if !redundant {
+				s = append(s, opt.name+optionEquals(false)+opt.value)
+			}
+			continue
+		}
+		var singleOption []string
+
+		commentPath := opt.path
+		if _, ok := currentFile.comments[commentPath]; !ok {
+			commentPath = fmt.Sprintf("%s,%d,%d", pathIncludingParent, 999, i)
+		}
+		// Options with comments are kept for the sake of the comments
+		if redundant && currentFile.comments[commentPath] == nil {
+			continue
+		}
+
+		lc := LeadingComments(commentPath, depth+1)
+		if len(s) == 0 {
+			lc = strings.TrimPrefix(lc, "\n")
+		}
+		singleOption = append(singleOption, lc)
+		singleOption = append(singleOption, getIndentation(depth+1))
+		singleOption = append(singleOption, "option ")
+		singleOption = append(singleOption, opt.name)
+		singleOption = append(singleOption, optionEquals(true))
+		singleOption = append(singleOption, opt.value)
+		singleOption = append(singleOption, ";\n")
+		singleOption = append(singleOption, TrailingComments(commentPath, depth+1))
+
+		s = append(s, strings.Join(singleOption, ""))
+	}
+
+	return s
+}
+
+// Returns the JSON name protoc derives from a field name
+func defaultJsonName(name string) string {
+	var b []byte
+	upper := false
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c == '_' {
+			upper = true
+			continue
+		}
+		if upper && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper = false
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+// Separates the sections of a file
+func sectionBreak() string {
+	return strings.Repeat("\n", currentStyle.SectionBlankLines)
+}
+
+// Limits runs of blank lines to the number between sections
+func collapseBlankLines(s string) string {
+	n := currentStyle.SectionBlankLines
+	return strings.Replace(s, strings.Repeat("\n", n+2), strings.Repeat("\n", n+1), -1)
+}
+
+// Returns whether the author left a blank line between the elements at the
+// given paths, so that it can be kept. Without the source, the lines between
+// the elements that the comments do not account for are taken to be blank.
+// Elements with leading comments get a blank line anyway.
+func blankLineBetween(prevPath, path string) bool {
+	if len(LeadingComments(path, 0)) > 0 {
+		return false
+	}
+
+	prev, ok1 := currentFile.locations[prevPath]
+	next, ok2 := currentFile.locations[path]
+	if !ok1 || !ok2 || len(prev.GetSpan()) < 3 || len(next.GetSpan()) < 3 {
+		return false
+	}
+	prevEnd := prev.GetSpan()[0]
+	if len(prev.GetSpan()) == 4 {
+		prevEnd = prev.GetSpan()[2]
+	}
+	nextStart := next.GetSpan()[0]
+
+	if lines := sourceLines(); lines != nil && int(nextStart) <= len(lines) {
+		for l := prevEnd + 1; l < nextStart; l++ {
+			if len(strings.TrimSpace(lines[l])) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	gap := nextStart - prevEnd - 1
+	gap -= int32(strings.Count(next.GetLeadingComments(), "\n"))
+	gap -= int32(strings.Count(prev.GetTrailingComments(), "\n"))
+	return gap > 0
+}
+
+// Returns whether the line fits in the maximum line width of the style.
+func fitsLine(line string) bool {
+	if currentStyle.MaxLineWidth <= 0 {
+		return true
+	}
+	return lineWidth(line) <= currentStyle.MaxLineWidth
+}
+
+// Returns the width of the line on screen, with tabs stopping every 8 columns.
+func lineWidth(line string) int {
+	width := 0
+	for _, r := range strings.Replace(line, cellMark, " ", -1) {
+		if r == '\t' {
+			width += 8 - width%8
+		} else {
+			width += 1
+		}
+	}
+	return width
+}
+
+// Returns the bracketed options of the declaration, with one option per line
+// if the declaration would not fit in the maximum line width otherwise.
+func formatOptionList(declaration string, opts []string, depth int) string {
+	oneLine := `[` + strings.Join(opts, ", ") + `]`
+	if fitsLine(declaration + " " + oneLine + ";") {
+		return cellBreak() + oneLine
+	}
+
+	var s []string
+	s = append(s, cellBreak())
+	s = append(s, "[\n")
+	for i, opt := range opts {
+		s = append(s, getIndentation(depth+1))
+		s = append(s, opt)
+		if i < len(opts)-1 {
+			s = append(s, ",")
+		}
+		s = append(s, "\n")
+	}
+	s = append(s, getIndentation(depth))
+	s = append(s, "]")
+	return strings.Join(s, "")
+}
+
+// Returns the keyword that precedes the name of an import, if any
+func importModifier(file *FileDescriptorProto, index int) string {
+	for _, i := range file.GetPublicDependency() {
+		if int(i) == index {
+			return "public "
+		}
+	}
+	for _, i := range file.GetWeakDependency() {
+		if int(i) == index {
+			return "weak "
+		}
+	}
+	return ""
+}
+
 // Determines depth of indentation
 func getIndentation(depth int) string {
 	s := ""
 	for i := 0; i < depth; i++ {
-		s += INDENT
+		s += currentStyle.indent()
 	}
 	return s
 }
@@ -1171,139 +970,66 @@ func byteToValueString(b []byte, lastReadIndex int, t FieldDescriptorProto_Type)
 	var val string
 	// All the types of options
 	switch t {
-	case FieldDescriptorProto_TYPE_BOOL:
-		d, _ := proto.DecodeVarint(b[lastReadIndex:])
-		if int(d) == 1 {
-			val = "true"
-		} else {
-			val = "false"
-		}
-		lastReadIndex += 1
-
-	case FieldDescriptorProto_TYPE_UINT32, FieldDescriptorProto_TYPE_INT32, FieldDescriptorProto_TYPE_UINT64, FieldDescriptorProto_TYPE_INT64:
+	case FieldDescriptorProto_TYPE_BOOL, FieldDescriptorProto_TYPE_UINT32, FieldDescriptorProto_TYPE_INT32, FieldDescriptorProto_TYPE_UINT64, FieldDescriptorProto_TYPE_INT64, FieldDescriptorProto_TYPE_SINT32, FieldDescriptorProto_TYPE_SINT64:
 		d, m := proto.DecodeVarint(b[lastReadIndex:])
 		lastReadIndex += m
-		//fmt.Printf("m: %v\n", m)
-		val = fmt.Sprintf("%v", d)
+		switch t {
+		case FieldDescriptorProto_TYPE_BOOL:
+			val = fmt.Sprintf("%v", d != 0)
+		case FieldDescriptorProto_TYPE_INT32:
+			val = fmt.Sprintf("%d", int32(d))
+		case FieldDescriptorProto_TYPE_INT64:
+			val = fmt.Sprintf("%d", int64(d))
+		case FieldDescriptorProto_TYPE_UINT32:
+			val = fmt.Sprintf("%d", uint32(d))
+		case FieldDescriptorProto_TYPE_SINT32:
+			val = fmt.Sprintf("%d", int32(uint32(d)>>1)^-int32(d&1))
+		case FieldDescriptorProto_TYPE_SINT64:
+			val = fmt.Sprintf("%d", int64(d>>1)^-int64(d&1))
+		default:
+			val = fmt.Sprintf("%d", d)
+		}
 
 	case FieldDescriptorProto_TYPE_FLOAT, FieldDescriptorProto_TYPE_SFIXED32, FieldDescriptorProto_TYPE_FIXED32:
-		var f float32
-		binary.Read(bytes.NewBuffer(b[lastReadIndex:]), binary.LittleEndian, &f)
-		lastReadIndex += 1
-		val = fmt.Sprintf("%v", f)
+		if len(b) < lastReadIndex+4 {
+			break
+		}
+		d := binary.LittleEndian.Uint32(b[lastReadIndex:])
+		lastReadIndex += 4
+		switch t {
+		case FieldDescriptorProto_TYPE_FLOAT:
+			val = formatFloat(float64(math.Float32frombits(d)), 32)
+		case FieldDescriptorProto_TYPE_SFIXED32:
+			val = fmt.Sprintf("%d", int32(d))
+		default:
+			val = fmt.Sprintf("%d", d)
+		}
 
 	case FieldDescriptorProto_TYPE_DOUBLE, FieldDescriptorProto_TYPE_SFIXED64, FieldDescriptorProto_TYPE_FIXED64:
-		var f float64
-		binary.Read(bytes.NewBuffer(b[lastReadIndex:]), binary.LittleEndian, &f)
-		lastReadIndex += 1
-		val = fmt.Sprintf("%v", f)
+		if len(b) < lastReadIndex+8 {
+			break
+		}
+		d := binary.LittleEndian.Uint64(b[lastReadIndex:])
+		lastReadIndex += 8
+		switch t {
+		case FieldDescriptorProto_TYPE_DOUBLE:
+			val = formatFloat(math.Float64frombits(d), 64)
+		case FieldDescriptorProto_TYPE_SFIXED64:
+			val = fmt.Sprintf("%d", int64(d))
+		default:
+			val = fmt.Sprintf("%d", d)
+		}
 
-	case FieldDescriptorProto_TYPE_STRING:
+	case FieldDescriptorProto_TYPE_STRING, FieldDescriptorProto_TYPE_BYTES:
 		l, n := proto.DecodeVarint(b[lastReadIndex:])
 		lastReadIndex += n
-		val = `"` + string(b[lastReadIndex:lastReadIndex+int(l)]) + `"`
+		if len(b) < lastReadIndex+int(l) {
+			break
+		}
+		val = quoteBytes(b[lastReadIndex:lastReadIndex+int(l)], t == FieldDescriptorProto_TYPE_STRING)
 		lastReadIndex += int(l)
 
 	}
 
 	return val, lastReadIndex
 }
-
-func getLastWordFromPath(s string, d string) string {
-	return strings.Split(s, d)[len(strings.Split(s, d))-1]
-}
-
-func scanNestedMessages(parent *DescriptorProto, typename string, parentStr string) (bool, string) {
-	found := false
-	val := ""
-	if parent.GetName() == typename {
-		var str string
-		if len(parentStr) == 0 {
-			str = typename
-		} else {
-			str = parentStr + "." + typename
-		}
-		return true, str
-	} else {
-		for _, mes := range parent.GetNestedType() {
-			var str string
-			if len(parentStr) == 0 {
-				str = parent.GetName()
-			} else {
-				str = parentStr + "." + parent.GetName()
-			}
-			b, val := scanNestedMessages(mes, typename, str)
-
-			if b {
-				return b, val
-			}
-		}
-	}
-
-	return found, val
-}
-
-func strcmp(a, b string) int {
-	var min = len(b)
-	if len(a) < len(b) {
-		min = len(a)
-	}
-	var diff int
-	for i := 0; i < min && diff == 0; i++ {
-		diff = int(a[i]) - int(b[i])
-	}
-	if diff == 0 {
-		diff = len(a) - len(b)
-	}
-	return diff
-}
-
-func sortSpecialOptions(opts []string) []string {
-	var vals []string
-
-	var s map[string]string
-	s = make(map[string]string)
-	r1, _ := regex.Compile(`option `)
-	r2, _ := regex.Compile(`([\s]*=[\s]*)`)
-	for _, opt := range opts {
-		b1 := r1.FindStringIndex(opt)
-		b2 := r2.FindStringIndex(opt)
-		s[opt[b1[1]:b2[0]]] = opt
-	}
-
-	var keys []string
-	for k := range s {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-	for _, k := range keys {
-		vals = append(vals, s[k])
-	}
-
-	return vals
-}
-
-func sortOptions(opts []string) []string {
-	var vals []string
-
-	var s map[string]string
-	s = make(map[string]string)
-	r1, _ := regex.Compile(`option [(]`)
-	r2, _ := regex.Compile(`[)]([\s]*=[\s]*)`)
-	for _, opt := range opts {
-		b1 := r1.FindStringIndex(opt)
-		b2 := r2.FindStringIndex(opt)
-		s[opt[b1[1]:b2[0]]] = opt
-	}
-
-	var keys []string
-	for k := range s {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-	for _, k := range keys {
-		vals = append(vals, s[k])
-	}
-
-	return vals
-}
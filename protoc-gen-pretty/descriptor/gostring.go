@@ -67,7 +67,7 @@ func (this *FieldDescriptorProto) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := strings.Join([]string{`&google_protobuf.FieldDescriptorProto{` + `Name:` + valueToGoStringDescriptor(this.Name, "string"), `Number:` + valueToGoStringDescriptor(this.Number, "int32"), `Label:` + valueToGoStringDescriptor(this.Label, "google_protobuf.FieldDescriptorProto_Label"), `Type:` + valueToGoStringDescriptor(this.Type, "google_protobuf.FieldDescriptorProto_Type"), `TypeName:` + valueToGoStringDescriptor(this.TypeName, "string"), `Extendee:` + valueToGoStringDescriptor(this.Extendee, "string"), `DefaultValue:` + valueToGoStringDescriptor(this.DefaultValue, "string"), `Options:` + fmt.Sprintf("%#v", this.Options), `XXX_unrecognized:` + fmt.Sprintf("%#v", this.XXX_unrecognized) + `}`}, ", ")
+	s := strings.Join([]string{`&google_protobuf.FieldDescriptorProto{` + `Name:` + valueToGoStringDescriptor(this.Name, "string"), `Number:` + valueToGoStringDescriptor(this.Number, "int32"), `Label:` + valueToGoStringDescriptor(this.Label, "google_protobuf.FieldDescriptorProto_Label"), `Type:` + valueToGoStringDescriptor(this.Type, "google_protobuf.FieldDescriptorProto_Type"), `TypeName:` + valueToGoStringDescriptor(this.TypeName, "string"), `Extendee:` + valueToGoStringDescriptor(this.Extendee, "string"), `DefaultValue:` + valueToGoStringDescriptor(this.DefaultValue, "string"), `Options:` + fmt.Sprintf("%#v", this.Options), `JsonName:` + valueToGoStringDescriptor(this.JsonName, "string"), `XXX_unrecognized:` + fmt.Sprintf("%#v", this.XXX_unrecognized) + `}`}, ", ")
 	return s
 }
 func (this *EnumDescriptorProto) GoString() string {
@@ -102,49 +102,49 @@ func (this *FileOptions) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := strings.Join([]string{`&google_protobuf.FileOptions{` + `JavaPackage:` + valueToGoStringDescriptor(this.JavaPackage, "string"), `JavaOuterClassname:` + valueToGoStringDescriptor(this.JavaOuterClassname, "string"), `JavaMultipleFiles:` + valueToGoStringDescriptor(this.JavaMultipleFiles, "bool"), `JavaGenerateEqualsAndHash:` + valueToGoStringDescriptor(this.JavaGenerateEqualsAndHash, "bool"), `OptimizeFor:` + valueToGoStringDescriptor(this.OptimizeFor, "google_protobuf.FileOptions_OptimizeMode"), `GoPackage:` + valueToGoStringDescriptor(this.GoPackage, "string"), `CcGenericServices:` + valueToGoStringDescriptor(this.CcGenericServices, "bool"), `JavaGenericServices:` + valueToGoStringDescriptor(this.JavaGenericServices, "bool"), `PyGenericServices:` + valueToGoStringDescriptor(this.PyGenericServices, "bool"), `UninterpretedOption:` + fmt.Sprintf("%#v", this.UninterpretedOption), `XXX_extensions: ` + extensionToGoStringDescriptor(this.XXX_extensions), `XXX_unrecognized:` + fmt.Sprintf("%#v", this.XXX_unrecognized) + `}`}, ", ")
+	s := strings.Join([]string{`&google_protobuf.FileOptions{` + `JavaPackage:` + valueToGoStringDescriptor(this.JavaPackage, "string"), `JavaOuterClassname:` + valueToGoStringDescriptor(this.JavaOuterClassname, "string"), `JavaMultipleFiles:` + valueToGoStringDescriptor(this.JavaMultipleFiles, "bool"), `JavaGenerateEqualsAndHash:` + valueToGoStringDescriptor(this.JavaGenerateEqualsAndHash, "bool"), `OptimizeFor:` + valueToGoStringDescriptor(this.OptimizeFor, "google_protobuf.FileOptions_OptimizeMode"), `GoPackage:` + valueToGoStringDescriptor(this.GoPackage, "string"), `CcGenericServices:` + valueToGoStringDescriptor(this.CcGenericServices, "bool"), `JavaGenericServices:` + valueToGoStringDescriptor(this.JavaGenericServices, "bool"), `PyGenericServices:` + valueToGoStringDescriptor(this.PyGenericServices, "bool"), `PhpGenericServices:` + valueToGoStringDescriptor(this.PhpGenericServices, "bool"), `JavaStringCheckUtf8:` + valueToGoStringDescriptor(this.JavaStringCheckUtf8, "bool"), `Deprecated:` + valueToGoStringDescriptor(this.Deprecated, "bool"), `CcEnableArenas:` + valueToGoStringDescriptor(this.CcEnableArenas, "bool"), `ObjcClassPrefix:` + valueToGoStringDescriptor(this.ObjcClassPrefix, "string"), `CsharpNamespace:` + valueToGoStringDescriptor(this.CsharpNamespace, "string"), `SwiftPrefix:` + valueToGoStringDescriptor(this.SwiftPrefix, "string"), `PhpClassPrefix:` + valueToGoStringDescriptor(this.PhpClassPrefix, "string"), `PhpNamespace:` + valueToGoStringDescriptor(this.PhpNamespace, "string"), `PhpMetadataNamespace:` + valueToGoStringDescriptor(this.PhpMetadataNamespace, "string"), `RubyPackage:` + valueToGoStringDescriptor(this.RubyPackage, "string"), `UninterpretedOption:` + fmt.Sprintf("%#v", this.UninterpretedOption), `XXX_extensions: ` + extensionToGoStringDescriptor(this.XXX_extensions), `XXX_unrecognized:` + fmt.Sprintf("%#v", this.XXX_unrecognized) + `}`}, ", ")
 	return s
 }
 func (this *MessageOptions) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := strings.Join([]string{`&google_protobuf.MessageOptions{` + `MessageSetWireFormat:` + valueToGoStringDescriptor(this.MessageSetWireFormat, "bool"), `NoStandardDescriptorAccessor:` + valueToGoStringDescriptor(this.NoStandardDescriptorAccessor, "bool"), `UninterpretedOption:` + fmt.Sprintf("%#v", this.UninterpretedOption), `XXX_extensions: ` + extensionToGoStringDescriptor(this.XXX_extensions), `XXX_unrecognized:` + fmt.Sprintf("%#v", this.XXX_unrecognized) + `}`}, ", ")
+	s := strings.Join([]string{`&google_protobuf.MessageOptions{` + `MessageSetWireFormat:` + valueToGoStringDescriptor(this.MessageSetWireFormat, "bool"), `NoStandardDescriptorAccessor:` + valueToGoStringDescriptor(this.NoStandardDescriptorAccessor, "bool"), `Deprecated:` + valueToGoStringDescriptor(this.Deprecated, "bool"), `UninterpretedOption:` + fmt.Sprintf("%#v", this.UninterpretedOption), `XXX_extensions: ` + extensionToGoStringDescriptor(this.XXX_extensions), `XXX_unrecognized:` + fmt.Sprintf("%#v", this.XXX_unrecognized) + `}`}, ", ")
 	return s
 }
 func (this *FieldOptions) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := strings.Join([]string{`&google_protobuf.FieldOptions{` + `Ctype:` + valueToGoStringDescriptor(this.Ctype, "google_protobuf.FieldOptions_CType"), `Packed:` + valueToGoStringDescriptor(this.Packed, "bool"), `Lazy:` + valueToGoStringDescriptor(this.Lazy, "bool"), `Deprecated:` + valueToGoStringDescriptor(this.Deprecated, "bool"), `ExperimentalMapKey:` + valueToGoStringDescriptor(this.ExperimentalMapKey, "string"), `Weak:` + valueToGoStringDescriptor(this.Weak, "bool"), `UninterpretedOption:` + fmt.Sprintf("%#v", this.UninterpretedOption), `XXX_extensions: ` + extensionToGoStringDescriptor(this.XXX_extensions), `XXX_unrecognized:` + fmt.Sprintf("%#v", this.XXX_unrecognized) + `}`}, ", ")
+	s := strings.Join([]string{`&google_protobuf.FieldOptions{` + `Ctype:` + valueToGoStringDescriptor(this.Ctype, "google_protobuf.FieldOptions_CType"), `Jstype:` + valueToGoStringDescriptor(this.Jstype, "google_protobuf.FieldOptions_JSType"), `Packed:` + valueToGoStringDescriptor(this.Packed, "bool"), `Lazy:` + valueToGoStringDescriptor(this.Lazy, "bool"), `Deprecated:` + valueToGoStringDescriptor(this.Deprecated, "bool"), `ExperimentalMapKey:` + valueToGoStringDescriptor(this.ExperimentalMapKey, "string"), `Weak:` + valueToGoStringDescriptor(this.Weak, "bool"), `UninterpretedOption:` + fmt.Sprintf("%#v", this.UninterpretedOption), `XXX_extensions: ` + extensionToGoStringDescriptor(this.XXX_extensions), `XXX_unrecognized:` + fmt.Sprintf("%#v", this.XXX_unrecognized) + `}`}, ", ")
 	return s
 }
 func (this *EnumOptions) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := strings.Join([]string{`&google_protobuf.EnumOptions{` + `AllowAlias:` + valueToGoStringDescriptor(this.AllowAlias, "bool"), `UninterpretedOption:` + fmt.Sprintf("%#v", this.UninterpretedOption), `XXX_extensions: ` + extensionToGoStringDescriptor(this.XXX_extensions), `XXX_unrecognized:` + fmt.Sprintf("%#v", this.XXX_unrecognized) + `}`}, ", ")
+	s := strings.Join([]string{`&google_protobuf.EnumOptions{` + `AllowAlias:` + valueToGoStringDescriptor(this.AllowAlias, "bool"), `Deprecated:` + valueToGoStringDescriptor(this.Deprecated, "bool"), `UninterpretedOption:` + fmt.Sprintf("%#v", this.UninterpretedOption), `XXX_extensions: ` + extensionToGoStringDescriptor(this.XXX_extensions), `XXX_unrecognized:` + fmt.Sprintf("%#v", this.XXX_unrecognized) + `}`}, ", ")
 	return s
 }
 func (this *EnumValueOptions) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := strings.Join([]string{`&google_protobuf.EnumValueOptions{` + `UninterpretedOption:` + fmt.Sprintf("%#v", this.UninterpretedOption), `XXX_extensions: ` + extensionToGoStringDescriptor(this.XXX_extensions), `XXX_unrecognized:` + fmt.Sprintf("%#v", this.XXX_unrecognized) + `}`}, ", ")
+	s := strings.Join([]string{`&google_protobuf.EnumValueOptions{` + `Deprecated:` + valueToGoStringDescriptor(this.Deprecated, "bool"), `UninterpretedOption:` + fmt.Sprintf("%#v", this.UninterpretedOption), `XXX_extensions: ` + extensionToGoStringDescriptor(this.XXX_extensions), `XXX_unrecognized:` + fmt.Sprintf("%#v", this.XXX_unrecognized) + `}`}, ", ")
 	return s
 }
 func (this *ServiceOptions) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := strings.Join([]string{`&google_protobuf.ServiceOptions{` + `UninterpretedOption:` + fmt.Sprintf("%#v", this.UninterpretedOption), `XXX_extensions: ` + extensionToGoStringDescriptor(this.XXX_extensions), `XXX_unrecognized:` + fmt.Sprintf("%#v", this.XXX_unrecognized) + `}`}, ", ")
+	s := strings.Join([]string{`&google_protobuf.ServiceOptions{` + `Deprecated:` + valueToGoStringDescriptor(this.Deprecated, "bool"), `UninterpretedOption:` + fmt.Sprintf("%#v", this.UninterpretedOption), `XXX_extensions: ` + extensionToGoStringDescriptor(this.XXX_extensions), `XXX_unrecognized:` + fmt.Sprintf("%#v", this.XXX_unrecognized) + `}`}, ", ")
 	return s
 }
 func (this *MethodOptions) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := strings.Join([]string{`&google_protobuf.MethodOptions{` + `UninterpretedOption:` + fmt.Sprintf("%#v", this.UninterpretedOption), `XXX_extensions: ` + extensionToGoStringDescriptor(this.XXX_extensions), `XXX_unrecognized:` + fmt.Sprintf("%#v", this.XXX_unrecognized) + `}`}, ", ")
+	s := strings.Join([]string{`&google_protobuf.MethodOptions{` + `Deprecated:` + valueToGoStringDescriptor(this.Deprecated, "bool"), `IdempotencyLevel:` + valueToGoStringDescriptor(this.IdempotencyLevel, "google_protobuf.MethodOptions_IdempotencyLevel"), `UninterpretedOption:` + fmt.Sprintf("%#v", this.UninterpretedOption), `XXX_extensions: ` + extensionToGoStringDescriptor(this.XXX_extensions), `XXX_unrecognized:` + fmt.Sprintf("%#v", this.XXX_unrecognized) + `}`}, ", ")
 	return s
 }
 func (this *UninterpretedOption) GoString() string {
@@ -172,7 +172,7 @@ func (this *SourceCodeInfo_Location) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := strings.Join([]string{`&google_protobuf.SourceCodeInfo_Location{` + `Path:` + fmt.Sprintf("%#v", this.Path), `Span:` + fmt.Sprintf("%#v", this.Span), `LeadingComments:` + valueToGoStringDescriptor(this.LeadingComments, "string"), `TrailingComments:` + valueToGoStringDescriptor(this.TrailingComments, "string"), `XXX_unrecognized:` + fmt.Sprintf("%#v", this.XXX_unrecognized) + `}`}, ", ")
+	s := strings.Join([]string{`&google_protobuf.SourceCodeInfo_Location{` + `Path:` + fmt.Sprintf("%#v", this.Path), `Span:` + fmt.Sprintf("%#v", this.Span), `LeadingComments:` + valueToGoStringDescriptor(this.LeadingComments, "string"), `TrailingComments:` + valueToGoStringDescriptor(this.TrailingComments, "string"), `LeadingDetachedComments:` + fmt.Sprintf("%#v", this.LeadingDetachedComments), `XXX_unrecognized:` + fmt.Sprintf("%#v", this.XXX_unrecognized) + `}`}, ", ")
 	return s
 }
 func valueToGoStringDescriptor(v interface{}, typ string) string {
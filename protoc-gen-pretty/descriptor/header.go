@@ -0,0 +1,88 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package descriptor
+
+import (
+	strings "strings"
+)
+
+// headerLocation returns the location of the first element of the file.
+// Comments above it that are separated from it by a blank line form the
+// header of the file.
+func headerLocation(file *FileDescriptorProto) *SourceCodeInfo_Location {
+	var first *SourceCodeInfo_Location
+	for _, loc := range file.GetSourceCodeInfo().GetLocation() {
+		// The location of the file itself spans everything
+		if len(loc.GetPath()) == 0 || len(loc.GetSpan()) < 3 {
+			continue
+		}
+		if first == nil || loc.GetSpan()[0] < first.GetSpan()[0] ||
+			(loc.GetSpan()[0] == first.GetSpan()[0] && loc.GetSpan()[1] < first.GetSpan()[1]) {
+			first = loc
+		}
+	}
+	return first
+}
+
+// FileHeader returns the header of the file with the given name, rebuilt from
+// the source info protoc recorded for it. It is used when the source itself
+// cannot be read.
+func (this *FileDescriptorSet) FileHeader(fileName string) string {
+	for _, file := range this.GetFile() {
+		if file.GetName() != fileName {
+			continue
+		}
+		loc := headerLocation(file)
+		if loc == nil || len(loc.GetLeadingDetachedComments()) == 0 {
+			return ""
+		}
+
+		var s []string
+		for _, comment := range loc.GetLeadingDetachedComments() {
+			for _, line := range strings.Split(strings.TrimSuffix(comment, "\n"), "\n") {
+				s = append(s, "//"+strings.TrimRight(line, " \t")+"\n")
+			}
+			s = append(s, "\n")
+		}
+		return strings.Join(s, "")
+	}
+	return ""
+}
+
+// DetachHeader stops the formatter from printing the comment directly above
+// the first element of the file with the given name, for when that comment is
+// part of the header that is printed as written.
+func (this *FileDescriptorSet) DetachHeader(fileName string) {
+	for _, file := range this.GetFile() {
+		if file.GetName() != fileName {
+			continue
+		}
+		if loc := headerLocation(file); loc != nil && loc.LeadingComments != nil {
+			loc.LeadingDetachedComments = append(loc.LeadingDetachedComments, loc.GetLeadingComments())
+			loc.LeadingComments = nil
+		}
+	}
+}
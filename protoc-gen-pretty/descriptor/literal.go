@@ -0,0 +1,104 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package descriptor
+
+import (
+	fmt "fmt"
+	math "math"
+	strconv "strconv"
+	strings "strings"
+	utf8 "unicode/utf8"
+)
+
+// formatDefaultValue returns the default value of a field as a literal that
+// can be written after default=.  protoc stores string defaults unescaped and
+// bytes defaults already C-escaped.
+func formatDefaultValue(field *FieldDescriptorProto) string {
+	val := field.GetDefaultValue()
+	switch field.GetType() {
+	case FieldDescriptorProto_TYPE_STRING:
+		return quoteBytes([]byte(val), true)
+	case FieldDescriptorProto_TYPE_BYTES:
+		return `"` + val + `"`
+	}
+	return val
+}
+
+// quoteBytes returns b as a quoted string literal, using the escapes the
+// protobuf tokenizer understands.  When utf8Safe is set, valid multi-byte UTF-8
+// sequences are written as they are; otherwise every byte above 0x7e is
+// written as an octal escape.
+func quoteBytes(b []byte, utf8Safe bool) string {
+	var s []string
+	s = append(s, `"`)
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch c {
+		case '\n':
+			s = append(s, `\n`)
+		case '\r':
+			s = append(s, `\r`)
+		case '\t':
+			s = append(s, `\t`)
+		case '"':
+			s = append(s, `\"`)
+		case '\'':
+			s = append(s, `\'`)
+		case '\\':
+			s = append(s, `\\`)
+		default:
+			if c >= 0x80 && utf8Safe {
+				if r, size := utf8.DecodeRune(b[i:]); r != utf8.RuneError || size > 1 {
+					s = append(s, string(b[i:i+size]))
+					i += size
+					continue
+				}
+			}
+			if c < 0x20 || c >= 0x7f {
+				s = append(s, fmt.Sprintf(`\%03o`, c))
+			} else {
+				s = append(s, string(c))
+			}
+		}
+		i += 1
+	}
+	s = append(s, `"`)
+	return strings.Join(s, "")
+}
+
+// formatFloat returns the shortest literal that reads back as f at the given
+// precision, including the inf and nan identifiers.
+func formatFloat(f float64, bitSize int) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'g', -1, bitSize)
+}
@@ -0,0 +1,272 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package descriptor
+
+import (
+	proto "code.google.com/p/gogoprotobuf/proto"
+	fmt "fmt"
+	reflect "reflect"
+	strings "strings"
+)
+
+// Path is a SourceCodeInfo path: the field numbers and indices that lead from
+// the file to an element.  See descriptor.proto for its format.
+type Path []int32
+
+// String returns the path as comma-separated integers, which is how the
+// formatter keys the comments of a file.
+func (this Path) String() string {
+	var p []string
+	for _, n := range this {
+		p = append(p, fmt.Sprintf("%d", n))
+	}
+	return strings.Join(p, ",")
+}
+
+// Returns the path of the element with the given index in the list with the
+// given tag inside the element at this path.
+func (this Path) child(tag int32, index int) Path {
+	child := make(Path, len(this), len(this)+2)
+	copy(child, this)
+	return append(child, tag, int32(index))
+}
+
+func (this Path) hasPrefix(prefix Path) bool {
+	if len(this) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if this[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (this Path) equal(other Path) bool {
+	return len(this) == len(other) && this.hasPrefix(other)
+}
+
+// Location is where an element is written in its file.  Lines and columns are
+// 1-based, as in the warnings, and the end column is the one just after the
+// element.  Tabs advance the column to the next multiple of 8, as protoc
+// counts them.
+type Location struct {
+	File        string
+	StartLine   int
+	StartColumn int
+	EndLine     int
+	EndColumn   int
+}
+
+func (this Location) String() string {
+	return fmt.Sprintf("%s:%d:%d", this.File, this.StartLine, this.StartColumn)
+}
+
+// Location returns where the element at the given path is written, and false
+// if protoc did not report it, as for files parsed without source info.
+func (this *FileDescriptor) Location(path Path) (Location, bool) {
+	return locationOf(this.FileDescriptorProto, path)
+}
+
+func locationOf(file *FileDescriptorProto, path Path) (Location, bool) {
+	if path == nil {
+		return Location{}, false
+	}
+	for _, loc := range file.GetSourceCodeInfo().GetLocation() {
+		span := loc.GetSpan()
+		if !Path(loc.Path).equal(path) || len(span) < 3 {
+			continue
+		}
+		// The end line is left out when it is the start line
+		endLine, endColumn := span[0], span[2]
+		if len(span) == 4 {
+			endLine, endColumn = span[2], span[3]
+		}
+		return Location{
+			File:        file.GetName(),
+			StartLine:   int(span[0]) + 1,
+			StartColumn: int(span[1]) + 1,
+			EndLine:     int(endLine) + 1,
+			EndColumn:   int(endColumn) + 1,
+		}, true
+	}
+	return Location{}, false
+}
+
+// Path returns the path of the message, or nil if it was removed from its
+// file.
+func (this *Descriptor) Path() Path {
+	path, _ := this.pathOf()
+	return path
+}
+
+// Location returns where the message is written.
+func (this *Descriptor) Location() (Location, bool) {
+	return locationOf(this.file, this.Path())
+}
+
+// Path returns the path of the field, or nil if it was removed from its file.
+func (this *FieldDescriptor) Path() Path {
+	path, _ := this.pathOf()
+	return path
+}
+
+// Location returns where the field is written.
+func (this *FieldDescriptor) Location() (Location, bool) {
+	return locationOf(this.file, this.Path())
+}
+
+// Path returns the path of the enum, or nil if it was removed from its file.
+func (this *EnumDescriptor) Path() Path {
+	path, _ := this.pathOf()
+	return path
+}
+
+// Location returns where the enum is written.
+func (this *EnumDescriptor) Location() (Location, bool) {
+	return locationOf(this.file, this.Path())
+}
+
+// ValuePath returns the path of the value of the enum with the given name, or
+// nil if there is none.
+func (this *EnumDescriptor) ValuePath(name string) Path {
+	path := this.Path()
+	index := this.valueIndex(name)
+	if path == nil || index < 0 {
+		return nil
+	}
+	return path.child(enumValuePath, index)
+}
+
+// Path returns the path of the service, or nil if it was removed from its
+// file.
+func (this *ServiceDescriptor) Path() Path {
+	path, _ := this.pathOf()
+	return path
+}
+
+// Location returns where the service is written.
+func (this *ServiceDescriptor) Location() (Location, bool) {
+	return locationOf(this.file, this.Path())
+}
+
+// MethodPath returns the path of the method of the service with the given
+// name, or nil if there is none.
+func (this *ServiceDescriptor) MethodPath(name string) Path {
+	path := this.Path()
+	index := this.methodIndex(name)
+	if path == nil || index < 0 {
+		return nil
+	}
+	return path.child(methodDescriptorPath, index)
+}
+
+// The options messages, by the name that custom options extend.
+var optionsMessages = map[string]proto.Message{
+	fileOptionsName:      &FileOptions{},
+	messageOptionsName:   &MessageOptions{},
+	fieldOptionsName:     &FieldOptions{},
+	enumOptionsName:      &EnumOptions{},
+	enumValueOptionsName: &EnumValueOptions{},
+	serviceOptionsName:   &ServiceOptions{},
+	methodOptionsName:    &MethodOptions{},
+}
+
+// OptionPath returns the path of the option with the given name of the element
+// at the given path, or of the file if the path is empty.  The name is written
+// as in an option statement, with custom options between parentheses and
+// relative to the package of the file.  The path is the same whether the
+// option is set or not, but only an option that is set has a location.
+func (this *FileDescriptor) OptionPath(element Path, name string) (Path, error) {
+	tag, extendee, err := optionsOf(element)
+	if err != nil {
+		return nil, err
+	}
+	path := make(Path, len(element), len(element)+2)
+	copy(path, element)
+	path = append(path, tag)
+
+	if strings.HasPrefix(name, "(") && strings.HasSuffix(name, ")") {
+		ext := findOption(name[1:len(name)-1], extendee, packageScope(this.FileDescriptorProto))
+		if ext == nil {
+			return nil, fmt.Errorf("unknown option %s", name)
+		}
+		return append(path, ext.field.GetNumber()), nil
+	}
+	options := reflect.TypeOf(optionsMessages[extendee]).Elem()
+	for _, prop := range proto.GetProperties(options).Prop {
+		if prop.OrigName == name && prop.Tag != 0 && !hiddenOptions[name] {
+			return append(path, int32(prop.Tag)), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown option %s", name)
+}
+
+// Returns the tag of the options of the element at the path, and the name of
+// the options message, by following the path from the file down.
+func optionsOf(path Path) (int32, string, error) {
+	const (
+		file = iota
+		message
+		field
+		enum
+		enumValue
+		service
+		method
+	)
+	// The kinds of element that the lists of each kind of element hold
+	lists := map[int]map[int32]int{
+		file:    {messagePath: message, enumPath: enum, servicePath: service, extendPath: field},
+		message: {messageFieldPath: field, messageMessagePath: message, messageEnumPath: enum, messageExtensionPath: field},
+		enum:    {enumValuePath: enumValue},
+		service: {methodDescriptorPath: method},
+	}
+	kind := file
+	for i := 0; i < len(path); i += 2 {
+		next, ok := lists[kind][path[i]]
+		if !ok || i+1 == len(path) {
+			return 0, "", fmt.Errorf("%v is not the path of an element with options", path)
+		}
+		kind = next
+	}
+
+	switch kind {
+	case message:
+		return messageOptionsPath, messageOptionsName, nil
+	case field:
+		return fieldOptionsPath, fieldOptionsName, nil
+	case enum:
+		return enumOptionsPath, enumOptionsName, nil
+	case enumValue:
+		return enumValueOptionsPath, enumValueOptionsName, nil
+	case service:
+		return serviceOptionsPath, serviceOptionsName, nil
+	case method:
+		return methodOptionsPath, methodOptionsName, nil
+	}
+	return optionsPath, fileOptionsName, nil
+}
@@ -0,0 +1,529 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package descriptor
+
+import (
+	proto "code.google.com/p/gogoprotobuf/proto"
+	fmt "fmt"
+	reflect "reflect"
+	sort "sort"
+	strings "strings"
+)
+
+// The fully-qualified names of the messages that options extend.
+const (
+	fileOptionsName      = ".google.protobuf.FileOptions"
+	messageOptionsName   = ".google.protobuf.MessageOptions"
+	fieldOptionsName     = ".google.protobuf.FieldOptions"
+	enumOptionsName      = ".google.protobuf.EnumOptions"
+	enumValueOptionsName = ".google.protobuf.EnumValueOptions"
+	serviceOptionsName   = ".google.protobuf.ServiceOptions"
+	methodOptionsName    = ".google.protobuf.MethodOptions"
+)
+
+// optionValue is a single option assignment decoded from an extension.  A
+// repeated option yields one optionValue per element and an option of message
+// type yields one optionValue per sub-field that is set, so that every value
+// can be printed as its own option statement.  Repeated and empty messages
+// cannot be set a sub-field at a time and are printed as an aggregate value.
+type optionValue struct {
+	name    string // The option name, including parentheses: (pkg.opt)
+	subPath string // The sub-field path for message options: .limits.max
+	value   string // The formatted value
+	path    string // The SourceCodeInfo path of the interpreted option
+	index   int    // The position of the statement, used for older comment paths
+	line    int32  // The line of the statement in the source, or -1 if unknown
+}
+
+type optionValues []*optionValue
+
+func (o optionValues) Len() int      { return len(o) }
+func (o optionValues) Swap(i, j int) { o[i], o[j] = o[j], o[i] }
+func (o optionValues) Less(i, j int) bool {
+	if o[i].name != o[j].name {
+		return o[i].name < o[j].name
+	}
+	// Statements setting the same option keep their order in the source.
+	return sourceBefore(o[i], o[j])
+}
+
+// optionsBySource orders option statements as they appear in the source.
+type optionsBySource struct {
+	optionValues
+}
+
+func (o optionsBySource) Less(i, j int) bool {
+	return sourceBefore(o.optionValues[i], o.optionValues[j])
+}
+
+// sourceBefore returns whether a is written before b.  Statements without a
+// source line come after the others, and ties keep the order they were
+// decoded in, so that any two statements compare the same way every time.
+func sourceBefore(a, b *optionValue) bool {
+	if (a.line < 0) != (b.line < 0) {
+		return b.line < 0
+	}
+	if a.line != b.line {
+		return a.line < b.line
+	}
+	return a.index < b.index
+}
+
+// sortOptionValues orders option statements in the order of the style.
+func sortOptionValues(opts optionValues) {
+	if currentStyle.OptionOrder == OptionOrderSource {
+		sort.Stable(optionsBySource{opts})
+	} else {
+		sort.Stable(opts)
+	}
+}
+
+// sourceLine returns the line of the location of the given path, or -1 if it
+// is unknown.
+func sourceLine(path string) int32 {
+	if loc, ok := currentFile.locations[path]; ok && len(loc.GetSpan()) > 0 {
+		return loc.GetSpan()[0]
+	}
+	return -1
+}
+
+// wireRecord is a single key/value pair read from the protobuf wire format.
+type wireRecord struct {
+	number   int32
+	wireType uint64
+	value    []byte // The encoded value, including the length prefix of length-delimited values
+	payload  []byte // The bytes of a length-delimited value, without the prefix
+}
+
+// readWireRecords splits encoded bytes into their key/value pairs.  Reading
+// stops at the first malformed record or group.
+func readWireRecords(b []byte) []wireRecord {
+	var records []wireRecord
+	for len(b) > 0 {
+		key, n := proto.DecodeVarint(b)
+		if n == 0 {
+			break
+		}
+		b = b[n:]
+		rec := wireRecord{number: int32(key >> 3), wireType: key & 0x7}
+
+		var size int
+		switch rec.wireType {
+		case 0:
+			_, size = proto.DecodeVarint(b)
+		case 1:
+			size = 8
+		case 2:
+			l, m := proto.DecodeVarint(b)
+			if m == 0 || m+int(l) > len(b) {
+				return records
+			}
+			size = m + int(l)
+			rec.payload = b[m:size]
+		case 5:
+			size = 4
+		}
+		if size == 0 || size > len(b) {
+			return records
+		}
+		rec.value = b[:size]
+		b = b[size:]
+		records = append(records, rec)
+	}
+	return records
+}
+
+// unpackRecords splits a packed repeated value into one record per element.
+func unpackRecords(rec wireRecord, field *FieldDescriptorProto) []wireRecord {
+	var records []wireRecord
+	wireType := uint64(field.WireType())
+	b := rec.payload
+	for len(b) > 0 {
+		var size int
+		switch wireType {
+		case 0:
+			_, size = proto.DecodeVarint(b)
+		case 1:
+			size = 8
+		case 5:
+			size = 4
+		}
+		if size == 0 || size > len(b) {
+			break
+		}
+		records = append(records, wireRecord{number: rec.number, wireType: wireType, value: b[:size]})
+		b = b[size:]
+	}
+	return records
+}
+
+// decodeExtensionMap decodes every extension in the map that belongs to a
+// known option, in a stable order.
+func decodeExtensionMap(extensionMap map[int32]proto.Extension, extendee string, pathIncludingParent string) []*optionValue {
+	var keys []int
+	for optInd := range extensionMap {
+		keys = append(keys, int(optInd))
+	}
+	sort.Ints(keys)
+
+	var opts optionValues
+	for _, optInd := range keys {
+		path := fmt.Sprintf("%s,%d", pathIncludingParent, optInd)
+		ext := findExtension(extendee, int32(optInd))
+		if ext == nil {
+			if opt := unknownOptionValue(extendee, int32(optInd), path); opt != nil {
+				opts = append(opts, opt)
+			}
+			continue
+		}
+		raw, err := proto.GetRawExtension(extensionMap, int32(optInd))
+		if err != nil {
+			continue
+		}
+		name := optionName(ext)
+		for _, opt := range decodeOptionValues(ext.field, raw, "", path) {
+			opt.name = name
+			opts = append(opts, opt)
+		}
+	}
+	for i, opt := range opts {
+		opt.index = i
+		opt.line = sourceLine(opt.path)
+	}
+	sortOptionValues(opts)
+
+	return opts
+}
+
+// unknownOptionValue recovers an option whose extension is not defined in any
+// of the files from its statement in the source.  The option is dropped if the
+// source is not available.
+func unknownOptionValue(extendee string, number int32, path string) *optionValue {
+	var name, value string
+	text, ok := spanText(path)
+	if ok {
+		name, value, ok = splitOptionStatement(text)
+	}
+	if !ok {
+		warnLostAt(path, "option with field number %d of %s is not defined in any imported file and was dropped", number, strings.TrimPrefix(extendee, "."))
+		return nil
+	}
+	warnAt(path, "option %s is not defined in any imported file, printed as written", name)
+	return &optionValue{name: name, value: value, path: path}
+}
+
+// splitOptionStatement splits the source of an option statement or of a field
+// option into the option name and its value.
+func splitOptionStatement(text string) (string, string, bool) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "option ") || strings.HasPrefix(text, "option(") {
+		text = text[len("option"):]
+	}
+	text = strings.TrimSpace(strings.TrimSuffix(text, ";"))
+
+	depth := 0
+	for i, c := range text {
+		switch c {
+		case '(':
+			depth += 1
+		case ')':
+			depth -= 1
+		case '=':
+			if depth == 0 {
+				return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// decodeUninterpretedOptions returns the options protoc could not interpret,
+// rebuilt from the parts the parser recorded for them.
+func decodeUninterpretedOptions(uninterpreted []*UninterpretedOption, pathIncludingParent string) optionValues {
+	var opts optionValues
+	for i, u := range uninterpreted {
+		path := fmt.Sprintf("%s,%d,%d", pathIncludingParent, 999, i)
+		opt := &optionValue{name: uninterpretedName(u), value: uninterpretedValue(u), path: path, index: i, line: sourceLine(path)}
+		warnAt(path, "option %s was not interpreted by protoc, printed as written", opt.name)
+		opts = append(opts, opt)
+	}
+	return opts
+}
+
+// uninterpretedName returns the name of an uninterpreted option as written:
+// (pkg.opt).field
+func uninterpretedName(u *UninterpretedOption) string {
+	var parts []string
+	for _, part := range u.GetName() {
+		if part.GetIsExtension() {
+			parts = append(parts, "("+part.GetNamePart()+")")
+		} else {
+			parts = append(parts, part.GetNamePart())
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// uninterpretedValue returns the value of an uninterpreted option as written.
+func uninterpretedValue(u *UninterpretedOption) string {
+	switch {
+	case u.IdentifierValue != nil:
+		return u.GetIdentifierValue()
+	case u.PositiveIntValue != nil:
+		return fmt.Sprintf("%d", u.GetPositiveIntValue())
+	case u.NegativeIntValue != nil:
+		return fmt.Sprintf("%d", u.GetNegativeIntValue())
+	case u.DoubleValue != nil:
+		return formatFloat(u.GetDoubleValue(), 64)
+	case u.StringValue != nil:
+		return quoteBytes(u.GetStringValue(), true)
+	case u.AggregateValue != nil:
+		return "{" + u.GetAggregateValue() + "}"
+	}
+	return ""
+}
+
+// hiddenOptions are fields of the options messages that cannot be written as
+// an option statement.
+var hiddenOptions = map[string]bool{
+	"uninterpreted_option":   true,
+	"interpreted_customtype": true,
+}
+
+// decodeBuiltinOptions decodes the options that descriptor.proto declares
+// itself, in the order of their declaration.  The fields of the options message
+// are read through their protobuf tags, so every built-in option that is set is
+// found without naming it here.
+func decodeBuiltinOptions(options proto.Message, pathIncludingParent string) optionValues {
+	v := reflect.ValueOf(options)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil
+	}
+	v = v.Elem()
+
+	var opts optionValues
+	for i, prop := range proto.GetProperties(v.Type()).Prop {
+		f := v.Field(i)
+		if prop.Tag == 0 || hiddenOptions[prop.OrigName] || f.Kind() != reflect.Ptr || f.IsNil() {
+			continue
+		}
+		path := fmt.Sprintf("%s,%d", pathIncludingParent, prop.Tag)
+		opts = append(opts, &optionValue{
+			name:  prop.OrigName,
+			value: builtinOptionValue(f.Elem()),
+			path:  path,
+			line:  sourceLine(path),
+		})
+	}
+	opts = append(opts, unrecognizedBuiltinOptions(v, pathIncludingParent)...)
+	for i, opt := range opts {
+		opt.index = i
+	}
+
+	return opts
+}
+
+// unrecognizedBuiltinOptions recovers the built-in options that are newer than
+// the options messages of this package from their statements in the source.
+// protoc sets them all the same, and they end up among the unrecognized fields.
+// Options whose source is not available are dropped.
+func unrecognizedBuiltinOptions(v reflect.Value, pathIncludingParent string) optionValues {
+	unrecognized := v.FieldByName("XXX_unrecognized")
+	if !unrecognized.IsValid() {
+		return nil
+	}
+
+	var opts optionValues
+	count := make(map[int32]int)
+	for _, rec := range readWireRecords(unrecognized.Bytes()) {
+		// Repeated options have a location for every element
+		path := fmt.Sprintf("%s,%d", pathIncludingParent, rec.number)
+		if elemPath := fmt.Sprintf("%s,%d", path, count[rec.number]); currentFile.locations[elemPath] != nil {
+			path = elemPath
+		}
+		count[rec.number] += 1
+
+		var name, value string
+		text, ok := spanText(path)
+		if ok {
+			name, value, ok = splitOptionStatement(text)
+		}
+		if !ok {
+			warnLostAt(path, "option with field number %d of google.protobuf.%s is not known to the formatter and was dropped", rec.number, v.Type().Name())
+			continue
+		}
+		warnAt(path, "option %s is not known to the formatter, printed as written", name)
+		opts = append(opts, &optionValue{name: name, value: value, path: path, line: sourceLine(path)})
+	}
+	return opts
+}
+
+// builtinOptionValue returns the source representation of the value of a
+// built-in option.  Enums print their value name.
+func builtinOptionValue(v reflect.Value) string {
+	if v.Kind() == reflect.String {
+		return quoteBytes([]byte(v.String()), true)
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+// decodeOptionValues decodes all the values of field found in b.  Message
+// values are expanded into their sub-fields, each with its own sub-path,
+// unless the field is repeated or the message is empty.
+func decodeOptionValues(field *FieldDescriptorProto, b []byte, subPath string, path string) []*optionValue {
+	var opts []*optionValue
+	index := 0
+	for _, rec := range readWireRecords(b) {
+		if rec.number != field.GetNumber() {
+			continue
+		}
+		elemPath := path
+		if field.IsRepeated() {
+			elemPath = fmt.Sprintf("%s,%d", path, index)
+		}
+		index += 1
+
+		switch {
+		case field.IsMessage():
+			msg := findMessage(field.GetTypeName())
+			if msg == nil {
+				continue
+			}
+			if field.IsRepeated() || len(readWireRecords(rec.payload)) == 0 {
+				opts = append(opts, &optionValue{subPath: subPath, value: formatAggregate(msg, rec.payload), path: elemPath})
+				continue
+			}
+			for _, subField := range msg.GetField() {
+				subFieldPath := fmt.Sprintf("%s,%d", elemPath, subField.GetNumber())
+				opts = append(opts, decodeOptionValues(subField, rec.payload, subPath+"."+subField.GetName(), subFieldPath)...)
+			}
+		case rec.wireType == 2 && field.WireType() != 2:
+			for _, elem := range unpackRecords(rec, field) {
+				opts = append(opts, &optionValue{subPath: subPath, value: formatOptionValue(field, elem), path: elemPath})
+			}
+		default:
+			opts = append(opts, &optionValue{subPath: subPath, value: formatOptionValue(field, rec), path: elemPath})
+		}
+	}
+	return opts
+}
+
+// formatAggregate returns the source representation of a message value in the
+// text format, as it is written between braces: { name: "a" limits { max: 5 } }
+func formatAggregate(msg *DescriptorProto, b []byte) string {
+	var s []string
+	for _, field := range msg.GetField() {
+		for _, rec := range readWireRecords(b) {
+			if rec.number != field.GetNumber() {
+				continue
+			}
+			switch {
+			case field.IsMessage():
+				sub := findMessage(field.GetTypeName())
+				if sub == nil {
+					continue
+				}
+				s = append(s, field.GetName()+" "+formatAggregate(sub, rec.payload))
+			case rec.wireType == 2 && field.WireType() != 2:
+				for _, elem := range unpackRecords(rec, field) {
+					s = append(s, field.GetName()+": "+formatOptionValue(field, elem))
+				}
+			default:
+				s = append(s, field.GetName()+": "+formatOptionValue(field, rec))
+			}
+		}
+	}
+	if len(s) == 0 {
+		return "{}"
+	}
+	return "{ " + strings.Join(s, " ") + " }"
+}
+
+// formatOptionValue returns the source representation of a single scalar or
+// enum value.
+func formatOptionValue(field *FieldDescriptorProto, rec wireRecord) string {
+	if field.IsEnum() {
+		d, _ := proto.DecodeVarint(rec.value)
+		return findEnumValueName(field.GetTypeName(), int32(d))
+	}
+	val, _ := byteToValueString(rec.value, 0, field.GetType())
+	return val
+}
+
+// findExtension returns the extension of the given options message with the
+// given field number.  Extensions declared inside messages are found as well.
+func findExtension(extendee string, number int32) *symbol {
+	if exts, ok := extensionsByExtendee[extendee]; ok {
+		return exts[number]
+	}
+	return nil
+}
+
+// findMessage returns the message with the given fully-qualified type name.
+func findMessage(typeName string) *DescriptorProto {
+	if sym := lookupSymbol(typeName, messageSymbol); sym != nil {
+		return sym.msg
+	}
+	return nil
+}
+
+// findEnumValueName returns the name of the value with the given number in the
+// enum with the given fully-qualified type name.
+func findEnumValueName(typeName string, number int32) string {
+	if sym := lookupSymbol(typeName, enumSymbol); sym != nil {
+		for _, enumVal := range sym.enum.GetValue() {
+			if enumVal.GetNumber() == number {
+				return enumVal.GetName()
+			}
+		}
+	}
+	return fmt.Sprintf("%d", number)
+}
+
+// Names to print custom options under instead of their own, by the
+// fully-qualified name of the option.
+var optionRenames map[string]string
+
+// RenameOptions makes the formatter print custom options under other names.
+// Both the keys and the values are fully-qualified option names, without the
+// parentheses.  Nil prints every option under its own name again.
+func RenameOptions(renames map[string]string) {
+	optionRenames = renames
+}
+
+// optionName returns the name of a custom option as it is written between
+// parentheses.  Options of the file being formatted are named relative to its
+// package, all others by their fully-qualified name.
+func optionName(ext *symbol) string {
+	if name, ok := optionRenames[strings.TrimPrefix(ext.name, ".")]; ok {
+		return "(" + name + ")"
+	}
+	name := strings.TrimPrefix(ext.name, ".")
+	if ext.file.GetName() == currentFile.GetName() && len(ext.file.GetPackage()) > 0 {
+		name = strings.TrimPrefix(name, ext.file.GetPackage()+".")
+	}
+	return "(" + name + ")"
+}
@@ -0,0 +1,160 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package descriptor
+
+import (
+	strings "strings"
+)
+
+// resolveName looks up a type name the way protoc does from within the given
+// scope, and returns the fully-qualified name it refers to or "" if it does
+// not resolve.  The first part of a relative name is searched for in the
+// scope and then in each enclosing scope in turn.
+func resolveName(name string, scope string) string {
+	if strings.HasPrefix(name, ".") {
+		if _, ok := symbols[name]; ok {
+			return name
+		}
+		return ""
+	}
+
+	first, rest := name, ""
+	if i := strings.Index(name, "."); i >= 0 {
+		first, rest = name[:i], name[i:]
+	}
+	for {
+		candidate := scope + "." + first
+		if sym, ok := symbols[candidate]; ok {
+			if len(rest) == 0 {
+				// Names of other kinds do not hide types.
+				if sym.isType() {
+					return candidate
+				}
+			} else if sym.isAggregate() {
+				// The rest of the name must be found in here, protoc does not
+				// backtrack to an outer scope.
+				if _, ok := symbols[candidate+rest]; ok {
+					return candidate + rest
+				}
+				return ""
+			}
+		}
+		if len(scope) == 0 {
+			return ""
+		}
+		scope = scope[:strings.LastIndex(scope, ".")]
+	}
+}
+
+// shortestName returns the shortest name that refers to the type with the
+// given fully-qualified name from within scope.  If no relative name does, the
+// fully-qualified name is returned with its leading dot.
+func shortestName(typeName string, scope string) string {
+	parts := strings.Split(strings.TrimPrefix(typeName, "."), ".")
+	for i := len(parts) - 1; i >= 0; i-- {
+		name := strings.Join(parts[i:], ".")
+		if resolveName(name, scope) == typeName {
+			return name
+		}
+	}
+	return typeName
+}
+
+// qualifiedName returns the fully-qualified name of a type as it can be
+// written from within scope.  The leading dot is only kept when the name would
+// otherwise resolve to another type.
+func qualifiedName(typeName string, scope string) string {
+	name := strings.TrimPrefix(typeName, ".")
+	if resolveName(name, scope) == typeName {
+		return name
+	}
+	return typeName
+}
+
+// typeNameInScope returns a reference to the type with the given
+// fully-qualified name, written from within scope in the current style.
+func typeNameInScope(typeName string, scope string) string {
+	if !strings.HasPrefix(typeName, ".") {
+		return typeName
+	}
+	if currentStyle.QualifiedTypeNames {
+		return qualifiedName(typeName, scope)
+	}
+	return shortestName(typeName, scope)
+}
+
+// Messages and enums can be the type of a field.
+func (this *symbol) isType() bool {
+	return this.kind == messageSymbol || this.kind == enumSymbol
+}
+
+// Names can be looked up inside packages, messages, enums and services.
+func (this *symbol) isAggregate() bool {
+	return this.kind == packageSymbol || this.kind == messageSymbol || this.kind == enumSymbol || this.kind == serviceSymbol
+}
+
+// packageScope returns the scope of the top-level elements of a file.
+func packageScope(file *FileDescriptorProto) string {
+	if len(file.GetPackage()) == 0 {
+		return ""
+	}
+	return "." + file.GetPackage()
+}
+
+// fullName returns the fully-qualified name of the message, with a leading dot.
+func (this *Descriptor) fullName() string {
+	if this.parent != nil {
+		return this.parent.fullName() + "." + this.GetName()
+	}
+	return packageScope(this.file) + "." + this.GetName()
+}
+
+// scope returns the scope in which the type of the field is looked up: the
+// containing message, or the package for top-level extensions.
+func (this *FieldDescriptor) scope() string {
+	if this.parent != nil {
+		return this.parent.fullName()
+	}
+	return packageScope(this.file)
+}
+
+// fullName returns the fully-qualified name of the service, with a leading dot.
+func (this *ServiceDescriptor) fullName() string {
+	return packageScope(this.file) + "." + this.GetName()
+}
+
+// scope returns the scope in which the enum, and its values, are declared.
+func (this *EnumDescriptor) scope() string {
+	if this.parent != nil {
+		return this.parent.fullName()
+	}
+	return packageScope(this.file)
+}
+
+// fullName returns the fully-qualified name of the enum, with a leading dot.
+func (this *EnumDescriptor) fullName() string {
+	return this.scope() + "." + this.GetName()
+}
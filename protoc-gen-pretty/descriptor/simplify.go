@@ -0,0 +1,205 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package descriptor
+
+import (
+	proto "code.google.com/p/gogoprotobuf/proto"
+	reflect "reflect"
+	sort "sort"
+)
+
+// The built-in options that simplify leaves out when they are set to the
+// value they have anyway, by name and value as they are printed.
+var redundantOptions = map[string]string{
+	"deprecated":   "false",
+	"optimize_for": "SPEED",
+}
+
+// Returns whether simplify leaves out the built-in option.
+func redundantOption(name, value string) bool {
+	v, ok := redundantOptions[name]
+	return ok && v == value
+}
+
+// Returns whether simplify leaves out the default value of the field, because
+// it is the value a scalar field has without one.
+func redundantDefault(field *FieldDescriptorProto) bool {
+	if field.DefaultValue == nil {
+		return false
+	}
+	switch field.GetType() {
+	case FieldDescriptorProto_TYPE_BOOL:
+		return field.GetDefaultValue() == "false"
+	case FieldDescriptorProto_TYPE_STRING, FieldDescriptorProto_TYPE_BYTES:
+		return len(field.GetDefaultValue()) == 0
+	case FieldDescriptorProto_TYPE_ENUM, FieldDescriptorProto_TYPE_MESSAGE, FieldDescriptorProto_TYPE_GROUP:
+		return false
+	}
+	// protoc prints a negative zero as "-0", which is not the same double
+	return field.GetDefaultValue() == "0"
+}
+
+// Equivalent returns whether the two files define the same things. Source info,
+// the order of declarations and what simplify leaves out do not count, so a
+// file can be compared with the result of formatting it.
+func Equivalent(a, b *FileDescriptorProto) bool {
+	return proto.Equal(canonicalFile(a), canonicalFile(b))
+}
+
+// Returns a copy of the file without what Equivalent ignores.
+func canonicalFile(file *FileDescriptorProto) *FileDescriptorProto {
+	file = proto.Clone(file).(*FileDescriptorProto)
+	file.SourceCodeInfo = nil
+	if canonicalOptions(file.Options) {
+		file.Options = nil
+	}
+	for _, message := range file.MessageType {
+		canonicalMessage(message)
+	}
+	for _, enum := range file.EnumType {
+		canonicalEnum(enum)
+	}
+	canonicalFields(file.Extension)
+	for _, service := range file.Service {
+		if canonicalOptions(service.Options) {
+			service.Options = nil
+		}
+		for _, method := range service.Method {
+			if canonicalOptions(method.Options) {
+				method.Options = nil
+			}
+		}
+		methods := service.Method
+		sort.Sort(lessSwap{len(methods), func(i, j int) bool { return methods[i].GetName() < methods[j].GetName() }, func(i, j int) { methods[i], methods[j] = methods[j], methods[i] }})
+	}
+
+	canonicalDependencies(file)
+	messages, enums, services := file.MessageType, file.EnumType, file.Service
+	sort.Sort(lessSwap{len(messages), func(i, j int) bool { return messages[i].GetName() < messages[j].GetName() }, func(i, j int) { messages[i], messages[j] = messages[j], messages[i] }})
+	sort.Sort(lessSwap{len(enums), func(i, j int) bool { return enums[i].GetName() < enums[j].GetName() }, func(i, j int) { enums[i], enums[j] = enums[j], enums[i] }})
+	sort.Sort(lessSwap{len(services), func(i, j int) bool { return services[i].GetName() < services[j].GetName() }, func(i, j int) { services[i], services[j] = services[j], services[i] }})
+	return file
+}
+
+// Sorts the imports, which the formatter does too, and the indices of the
+// public and weak ones with them.
+func canonicalDependencies(file *FileDescriptorProto) {
+	public := make(map[string]bool)
+	for _, i := range file.PublicDependency {
+		public[file.Dependency[i]] = true
+	}
+	weak := make(map[string]bool)
+	for _, i := range file.WeakDependency {
+		weak[file.Dependency[i]] = true
+	}
+
+	sort.Strings(file.Dependency)
+	file.PublicDependency, file.WeakDependency = nil, nil
+	for i, dependency := range file.Dependency {
+		if public[dependency] {
+			file.PublicDependency = append(file.PublicDependency, int32(i))
+		}
+		if weak[dependency] {
+			file.WeakDependency = append(file.WeakDependency, int32(i))
+		}
+	}
+}
+
+func canonicalMessage(message *DescriptorProto) {
+	if canonicalOptions(message.Options) {
+		message.Options = nil
+	}
+	canonicalFields(message.Field)
+	canonicalFields(message.Extension)
+	for _, nested := range message.NestedType {
+		canonicalMessage(nested)
+	}
+	for _, enum := range message.EnumType {
+		canonicalEnum(enum)
+	}
+
+	nested, enums := message.NestedType, message.EnumType
+	sort.Sort(lessSwap{len(nested), func(i, j int) bool { return nested[i].GetName() < nested[j].GetName() }, func(i, j int) { nested[i], nested[j] = nested[j], nested[i] }})
+	sort.Sort(lessSwap{len(enums), func(i, j int) bool { return enums[i].GetName() < enums[j].GetName() }, func(i, j int) { enums[i], enums[j] = enums[j], enums[i] }})
+}
+
+// Sorts fields by number, and extensions by extendee first.
+func canonicalFields(fields []*FieldDescriptorProto) {
+	for _, field := range fields {
+		if redundantDefault(field) {
+			field.DefaultValue = nil
+		}
+		// protoc only fills in the JSON name for plugins
+		if field.GetJsonName() == defaultJsonName(field.GetName()) {
+			field.JsonName = nil
+		}
+		if canonicalOptions(field.Options) {
+			field.Options = nil
+		}
+	}
+	sort.Sort(lessSwap{len(fields), func(i, j int) bool {
+		if fields[i].GetExtendee() != fields[j].GetExtendee() {
+			return fields[i].GetExtendee() < fields[j].GetExtendee()
+		}
+		return fields[i].GetNumber() < fields[j].GetNumber()
+	}, func(i, j int) { fields[i], fields[j] = fields[j], fields[i] }})
+}
+
+func canonicalEnum(enum *EnumDescriptorProto) {
+	if canonicalOptions(enum.Options) {
+		enum.Options = nil
+	}
+	for _, value := range enum.Value {
+		if canonicalOptions(value.Options) {
+			value.Options = nil
+		}
+	}
+	values := enum.Value
+	sort.Stable(lessSwap{len(values), func(i, j int) bool { return values[i].GetNumber() < values[j].GetNumber() }, func(i, j int) { values[i], values[j] = values[j], values[i] }})
+}
+
+// Clears the redundant built-in options, and returns whether nothing is left
+// of the options.
+func canonicalOptions(options proto.Message) bool {
+	v := reflect.ValueOf(options)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return false
+	}
+	v = v.Elem()
+
+	for i, prop := range proto.GetProperties(v.Type()).Prop {
+		f := v.Field(i)
+		if prop.Tag == 0 || f.Kind() != reflect.Ptr || f.IsNil() {
+			continue
+		}
+		if redundantOption(prop.OrigName, builtinOptionValue(f.Elem())) {
+			f.Set(reflect.Zero(f.Type()))
+		}
+	}
+
+	data, err := proto.Marshal(options)
+	return err == nil && len(data) == 0
+}
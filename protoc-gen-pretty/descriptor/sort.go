@@ -0,0 +1,67 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package descriptor
+
+import (
+	sort "sort"
+)
+
+// printOrder returns the indices of n elements in the order they are printed
+// in. That is the order of the source, unless the style sorts declarations,
+// in which case less orders them. Elements that are equal keep the order of
+// the source. The elements keep their own paths, so their comments go along
+// with them.
+func printOrder(n int, less func(i, j int) bool) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	if currentStyle.Sort {
+		sort.Stable(byLess{order, less})
+	}
+	return order
+}
+
+type byLess struct {
+	order []int
+	less  func(i, j int) bool
+}
+
+func (this byLess) Len() int           { return len(this.order) }
+func (this byLess) Swap(i, j int)      { this.order[i], this.order[j] = this.order[j], this.order[i] }
+func (this byLess) Less(i, j int) bool { return this.less(this.order[i], this.order[j]) }
+
+// lessSwap sorts a slice through the functions that compare and swap its
+// elements.
+type lessSwap struct {
+	n    int
+	less func(i, j int) bool
+	swap func(i, j int)
+}
+
+func (this lessSwap) Len() int           { return this.n }
+func (this lessSwap) Swap(i, j int)      { this.swap(i, j) }
+func (this lessSwap) Less(i, j int) bool { return this.less(i, j) }
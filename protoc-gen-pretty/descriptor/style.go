@@ -0,0 +1,207 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package descriptor
+
+import (
+	fmt "fmt"
+	strconv "strconv"
+	strings "strings"
+)
+
+const (
+	// Options are sorted by name
+	OptionOrderName = "name"
+	// Options keep the order in which they were written
+	OptionOrderSource = "source"
+
+	// Imports are printed as one sorted list
+	ImportGroupingNone = "none"
+	// Imports from different directories are separated by a blank line
+	ImportGroupingDirectory = "directory"
+
+	// "a = b" for built-in option statements and aggregate fields, "a=b"
+	// for custom options and field options
+	OptionSpacingMixed = "mixed"
+	// "a = b" everywhere
+	OptionSpacingSpaced = "spaced"
+	// "a=b" everywhere
+	OptionSpacingCompact = "compact"
+)
+
+// Style holds the choices the formatter makes that are a matter of taste.
+type Style struct {
+	// Print every type reference by its fully-qualified name instead of the
+	// shortest name that refers to the same type.
+	QualifiedTypeNames bool
+
+	// Number of spaces per level of indentation, unless UseTabs is set.
+	IndentWidth int
+	// Indent with a tab per level.
+	UseTabs bool
+	// Number of blank lines between the sections of a file.
+	SectionBlankLines int
+	// Close enums with "};" rather than "}".
+	EnumSemicolon bool
+	// One of OptionOrderName or OptionOrderSource.
+	OptionOrder string
+	// One of ImportGroupingNone or ImportGroupingDirectory.
+	ImportGrouping string
+	// One of OptionSpacingMixed, OptionSpacingSpaced or OptionSpacingCompact.
+	OptionSpacing string
+	// Line up the types, names, numbers, options and trailing comments of
+	// consecutive fields and enum values.
+	Align bool
+	// Lines longer than this are broken where the format allows it, or 0 for
+	// no limit.
+	MaxLineWidth int
+	// Put one space after every "//", and reflow the paragraphs of comments
+	// to CommentWidth. Lists, code and commented-out code are kept.
+	NormalizeComments bool
+	// Width of the lines of normalized comments, indentation included.
+	CommentWidth int
+	// Print top-level messages, enums and services by name, fields and enum
+	// values by number, and extends by extendee.
+	Sort bool
+	// Leave out defaults and built-in options that are set to the value they
+	// have anyway, like gofmt -s.
+	Simplify bool
+}
+
+// DefaultStyle returns the style used by Fmt.
+func DefaultStyle() *Style {
+	return &Style{
+		IndentWidth:       len(INDENT),
+		SectionBlankLines: 1,
+		EnumSemicolon:     true,
+		OptionOrder:       OptionOrderName,
+		ImportGrouping:    ImportGroupingNone,
+		OptionSpacing:     OptionSpacingMixed,
+		CommentWidth:      80,
+	}
+}
+
+var currentStyle = DefaultStyle()
+
+// Set changes the setting with the given key, as it is written in a
+// configuration file or a plugin parameter.
+func (this *Style) Set(key, value string) error {
+	switch key {
+	case "indent":
+		if value == "tab" || value == "tabs" {
+			this.UseTabs = true
+			return nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("indent must be a number of spaces or \"tab\", not %q", value)
+		}
+		this.IndentWidth = n
+		this.UseTabs = false
+	case "tabs":
+		return setBool(&this.UseTabs, key, value)
+	case "section_blank_lines":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("section_blank_lines must be a number, not %q", value)
+		}
+		this.SectionBlankLines = n
+	case "enum_semicolon":
+		return setBool(&this.EnumSemicolon, key, value)
+	case "option_order", "order":
+		return setChoice(&this.OptionOrder, key, value, OptionOrderName, OptionOrderSource)
+	case "import_grouping":
+		return setChoice(&this.ImportGrouping, key, value, ImportGroupingNone, ImportGroupingDirectory)
+	case "option_spacing":
+		return setChoice(&this.OptionSpacing, key, value, OptionSpacingMixed, OptionSpacingSpaced, OptionSpacingCompact)
+	case "qualified_types":
+		return setBool(&this.QualifiedTypeNames, key, value)
+	case "align":
+		return setBool(&this.Align, key, value)
+	case "max_line_width":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("max_line_width must be a number, not %q", value)
+		}
+		this.MaxLineWidth = n
+	case "normalize_comments":
+		return setBool(&this.NormalizeComments, key, value)
+	case "comment_width":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("comment_width must be a positive number, not %q", value)
+		}
+		this.CommentWidth = n
+	case "sort":
+		return setBool(&this.Sort, key, value)
+	case "simplify":
+		return setBool(&this.Simplify, key, value)
+	default:
+		return fmt.Errorf("unknown style setting %q", key)
+	}
+	return nil
+}
+
+func setBool(b *bool, key, value string) error {
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("%s must be true or false, not %q", key, value)
+	}
+	*b = v
+	return nil
+}
+
+func setChoice(s *string, key, value string, choices ...string) error {
+	for _, c := range choices {
+		if value == c {
+			*s = value
+			return nil
+		}
+	}
+	return fmt.Errorf("%s must be one of %s, not %q", key, strings.Join(choices, ", "), value)
+}
+
+// Returns one level of indentation.
+func (this *Style) indent() string {
+	if this.UseTabs {
+		return "\t"
+	}
+	return strings.Repeat(" ", this.IndentWidth)
+}
+
+// Returns the separator between the name and the value of an option. In the
+// mixed style only the places that were always spaced are spaced.
+func optionEquals(spaced bool) string {
+	switch currentStyle.OptionSpacing {
+	case OptionSpacingSpaced:
+		return " = "
+	case OptionSpacingCompact:
+		return "="
+	}
+	if spaced {
+		return " = "
+	}
+	return "="
+}
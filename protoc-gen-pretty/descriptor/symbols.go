@@ -0,0 +1,147 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package descriptor
+
+import (
+	strings "strings"
+)
+
+const (
+	packageSymbol = iota
+	messageSymbol
+	enumSymbol
+	enumValueSymbol
+	fieldSymbol
+	extensionSymbol
+	serviceSymbol
+	methodSymbol
+)
+
+// symbol is a named element declared in one of the files of the set.
+type symbol struct {
+	name  string // Fully-qualified, with a leading dot.
+	kind  int
+	file  *FileDescriptor
+	msg   *DescriptorProto
+	enum  *EnumDescriptorProto
+	field *FieldDescriptorProto
+}
+
+// All the symbols of the set, keyed by fully-qualified name with a leading dot.
+var symbols map[string]*symbol
+
+// All the extensions of the set, keyed by the fully-qualified name of the
+// extended message and then by field number.
+var extensionsByExtendee map[string]map[int32]*symbol
+
+// Builds the symbol table of every file in the set, including elements nested
+// inside messages.
+func buildSymbols(files []*FileDescriptor) {
+	symbols = make(map[string]*symbol)
+	extensionsByExtendee = make(map[string]map[int32]*symbol)
+	for _, file := range files {
+		scope := ""
+		if len(file.GetPackage()) > 0 {
+			for _, part := range strings.Split(file.GetPackage(), ".") {
+				scope += "." + part
+				addSymbol(&symbol{name: scope, kind: packageSymbol, file: file})
+			}
+		}
+		for _, msg := range file.GetMessageType() {
+			addMessageSymbols(file, scope, msg)
+		}
+		for _, enum := range file.GetEnumType() {
+			addEnumSymbols(file, scope, enum)
+		}
+		for _, ext := range file.GetExtension() {
+			addExtensionSymbol(file, scope, ext)
+		}
+		for _, serv := range file.GetService() {
+			name := scope + "." + serv.GetName()
+			addSymbol(&symbol{name: name, kind: serviceSymbol, file: file})
+			for _, method := range serv.GetMethod() {
+				addSymbol(&symbol{name: name + "." + method.GetName(), kind: methodSymbol, file: file})
+			}
+		}
+	}
+}
+
+func addMessageSymbols(file *FileDescriptor, scope string, msg *DescriptorProto) {
+	name := scope + "." + msg.GetName()
+	addSymbol(&symbol{name: name, kind: messageSymbol, file: file, msg: msg})
+	for _, field := range msg.GetField() {
+		addSymbol(&symbol{name: name + "." + field.GetName(), kind: fieldSymbol, file: file, field: field})
+	}
+	for _, nested := range msg.GetNestedType() {
+		addMessageSymbols(file, name, nested)
+	}
+	for _, enum := range msg.GetEnumType() {
+		addEnumSymbols(file, name, enum)
+	}
+	for _, ext := range msg.GetExtension() {
+		addExtensionSymbol(file, name, ext)
+	}
+}
+
+// Enum values are siblings of their enum, as in C++.
+func addEnumSymbols(file *FileDescriptor, scope string, enum *EnumDescriptorProto) {
+	addSymbol(&symbol{name: scope + "." + enum.GetName(), kind: enumSymbol, file: file, enum: enum})
+	for _, value := range enum.GetValue() {
+		addSymbol(&symbol{name: scope + "." + value.GetName(), kind: enumValueSymbol, file: file, enum: enum})
+	}
+}
+
+func addExtensionSymbol(file *FileDescriptor, scope string, ext *FieldDescriptorProto) {
+	sym := &symbol{name: scope + "." + ext.GetName(), kind: extensionSymbol, file: file, field: ext}
+	addSymbol(sym)
+	extendee := ext.GetExtendee()
+	if _, ok := extensionsByExtendee[extendee]; !ok {
+		extensionsByExtendee[extendee] = make(map[int32]*symbol)
+	}
+	extensionsByExtendee[extendee][ext.GetNumber()] = sym
+}
+
+// The first declaration of a name wins, as it does in protoc.
+func addSymbol(sym *symbol) {
+	if _, ok := symbols[sym.name]; !ok {
+		symbols[sym.name] = sym
+	}
+}
+
+// Returns the symbol with the given fully-qualified name if it is of the
+// given kind.
+func lookupSymbol(name string, kind int) *symbol {
+	if sym, ok := symbols[name]; ok && sym.kind == kind {
+		return sym
+	}
+	return nil
+}
+
+// Returns the scope in which the symbol was declared, ie. its name without the
+// last part.
+func (this *symbol) scope() string {
+	return this.name[:strings.LastIndex(this.name, ".")]
+}
@@ -0,0 +1,150 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package descriptor
+
+// Element describes an element of a file to a Visitor.
+type Element struct {
+	Parent   *Element // The element it is declared in, or nil at the top level.
+	Name     string   // The fully-qualified name, with a leading dot.
+	Path     Path     // The SourceCodeInfo path.
+	Leading  string   // The comments directly above the element.
+	Trailing string   // The comments after the element.
+	Detached []string // The comments above the leading ones, separated from them by blank lines.
+
+	// The element itself: a *Descriptor, *FieldDescriptor, *EnumDescriptor,
+	// *EnumValueDescriptorProto, *ServiceDescriptor or *MethodDescriptorProto.
+	Node interface{}
+}
+
+// A Visitor is called by Walk for every element of a file.  The callbacks of
+// elements that contain others return whether to walk into them.
+type Visitor interface {
+	VisitMessage(message *Descriptor, element *Element) bool
+	VisitField(field *FieldDescriptor, element *Element)
+	VisitExtension(extension *FieldDescriptor, element *Element)
+	VisitEnum(enum *EnumDescriptor, element *Element) bool
+	VisitEnumValue(value *EnumValueDescriptorProto, element *Element)
+	VisitService(service *ServiceDescriptor, element *Element) bool
+	VisitMethod(method *MethodDescriptorProto, element *Element)
+}
+
+// BaseVisitor walks into everything and does nothing else.  A Visitor can
+// embed it and implement only the callbacks it needs.
+type BaseVisitor struct{}
+
+func (this BaseVisitor) VisitMessage(message *Descriptor, element *Element) bool          { return true }
+func (this BaseVisitor) VisitField(field *FieldDescriptor, element *Element)              {}
+func (this BaseVisitor) VisitExtension(extension *FieldDescriptor, element *Element)      {}
+func (this BaseVisitor) VisitEnum(enum *EnumDescriptor, element *Element) bool            { return true }
+func (this BaseVisitor) VisitEnumValue(value *EnumValueDescriptorProto, element *Element) {}
+func (this BaseVisitor) VisitService(service *ServiceDescriptor, element *Element) bool   { return true }
+func (this BaseVisitor) VisitMethod(method *MethodDescriptorProto, element *Element)      {}
+
+// Walk calls the visitor for every element of the file, in the order of the
+// lists of the descriptor: messages, enums, extensions and services, and
+// inside a message its fields, nested messages, enums and extensions.  The
+// messages of groups are visited as messages.  The file is wrapped again
+// first, so that changes made through Edit are seen.
+func Walk(file *FileDescriptor, v Visitor) {
+	w := &walker{v, firstLocations(file.FileDescriptorProto)}
+	f := file.FileDescriptorProto
+	descs := wrapDescriptors(f)
+	buildNestedDescriptors(descs)
+
+	for _, desc := range descs {
+		if desc.parent == nil {
+			w.message(desc, nil, Path{messagePath, int32(desc.index)})
+		}
+	}
+	for i, enum := range wrapEnumDescriptors(f, descs) {
+		w.enum(enum, nil, Path{enumPath, int32(i)})
+	}
+	for i, ext := range wrapExtensions(f) {
+		w.visitor.VisitExtension(ext, w.element(ext, nil, ext.scope()+"."+ext.GetName(), Path{extendPath, int32(i)}))
+	}
+	for i, serv := range wrapServiceDescriptors(f) {
+		w.service(serv, Path{servicePath, int32(i)})
+	}
+}
+
+type walker struct {
+	visitor   Visitor
+	locations map[string]*SourceCodeInfo_Location
+}
+
+// Describes an element, with the comments of its location.
+func (this *walker) element(node interface{}, parent *Element, name string, path Path) *Element {
+	loc := this.locations[path.String()]
+	return &Element{
+		Parent:   parent,
+		Name:     name,
+		Path:     path,
+		Leading:  loc.GetLeadingComments(),
+		Trailing: loc.GetTrailingComments(),
+		Detached: loc.GetLeadingDetachedComments(),
+		Node:     node,
+	}
+}
+
+func (this *walker) message(desc *Descriptor, parent *Element, path Path) {
+	element := this.element(desc, parent, desc.fullName(), path)
+	if !this.visitor.VisitMessage(desc, element) {
+		return
+	}
+	for i, field := range desc.field {
+		this.visitor.VisitField(field, this.element(field, element, element.Name+"."+field.GetName(), path.child(messageFieldPath, i)))
+	}
+	for i, nested := range desc.nested {
+		this.message(nested, element, path.child(messageMessagePath, i))
+	}
+	for i, enum := range desc.enum {
+		this.enum(enum, element, path.child(messageEnumPath, i))
+	}
+	for i, ext := range desc.ext {
+		this.visitor.VisitExtension(ext, this.element(ext, element, element.Name+"."+ext.GetName(), path.child(messageExtensionPath, i)))
+	}
+}
+
+func (this *walker) enum(enum *EnumDescriptor, parent *Element, path Path) {
+	element := this.element(enum, parent, enum.fullName(), path)
+	if !this.visitor.VisitEnum(enum, element) {
+		return
+	}
+	// Enum values are siblings of their enum
+	for i, value := range enum.Value {
+		this.visitor.VisitEnumValue(value, this.element(value, element, enum.scope()+"."+value.GetName(), path.child(enumValuePath, i)))
+	}
+}
+
+func (this *walker) service(serv *ServiceDescriptor, path Path) {
+	element := this.element(serv, nil, serv.fullName(), path)
+	if !this.visitor.VisitService(serv, element) {
+		return
+	}
+	for i, method := range serv.Method {
+		this.visitor.VisitMethod(method, this.element(method, element, element.Name+"."+method.GetName(), path.child(methodDescriptorPath, i)))
+	}
+}
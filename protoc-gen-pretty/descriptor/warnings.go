@@ -0,0 +1,259 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package descriptor
+
+import (
+	fmt "fmt"
+	ioutil "io/ioutil"
+	strings "strings"
+)
+
+// A Warning reports something in a file that could not be formatted exactly,
+// such as an option that had to be printed as written in the source.
+type Warning struct {
+	File    string
+	Line    int // 1-based, or 0 if unknown
+	Column  int // 1-based, or 0 if unknown
+	Message string
+	Lost    bool // Set if the formatted file is missing what is reported
+}
+
+func (w Warning) String() string {
+	if w.Line == 0 {
+		return fmt.Sprintf("%s: %s", w.File, w.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", w.File, w.Line, w.Column, w.Message)
+}
+
+var warnings []Warning
+
+// Warnings returns the warnings produced while formatting the last file.
+func Warnings() []Warning {
+	return warnings
+}
+
+// warnAt records a warning at the source location of the given path.
+func warnAt(path string, format string, args ...interface{}) {
+	warnings = append(warnings, newWarning(currentFile.locations[path], format, args...))
+}
+
+// warnLostAt records a warning at the source location of the given path for
+// something the formatted file is missing.
+func warnLostAt(path string, format string, args ...interface{}) {
+	w := newWarning(currentFile.locations[path], format, args...)
+	w.Lost = true
+	warnings = append(warnings, w)
+}
+
+// warnDetachedComments records a warning for every comment that is separated
+// from the next element by a blank line, as the formatter does not print them.
+// The comments at the top of the file are kept as its header.
+func warnDetachedComments() {
+	header := headerLocation(currentFile.FileDescriptorProto)
+	for _, loc := range currentFile.GetSourceCodeInfo().GetLocation() {
+		if loc == header {
+			continue
+		}
+		for _, comment := range loc.GetLeadingDetachedComments() {
+			first := strings.TrimSpace(strings.Split(strings.TrimSpace(comment), "\n")[0])
+			if len(first) > 40 {
+				first = first[:40] + "..."
+			}
+			w := newWarning(loc, "unattached comment above this line is lost: %q", first)
+			w.Lost = true
+			warnings = append(warnings, w)
+		}
+	}
+}
+
+// The fields of the descriptors that are newer than this package, by the
+// number of the field, named as what the formatter leaves out without them.
+// Oneofs and the index of a field in its oneof are reported by themselves.
+var (
+	unknownFileFields    = map[int32]string{12: "a syntax statement", 14: "an edition statement"}
+	unknownMessageFields = map[int32]string{8: "", 9: "reserved ranges", 10: "reserved names"}
+	unknownFieldFields   = map[int32]string{9: "", 17: "a proto3 optional label"}
+	unknownEnumFields    = map[int32]string{4: "reserved ranges", 5: "reserved names"}
+	unknownMethodFields  = map[int32]string{5: "a client stream", 6: "a server stream"}
+	unknownRangeFields   = map[int32]string{3: "options"}
+)
+
+// warnUnrecognizedFields records a warning for every part of a declaration that
+// protoc reported in a field the descriptors of this package do not have, as
+// the formatter cannot print it.  Oneofs are printed as plain fields.
+func warnUnrecognizedFields() {
+	warnUnrecognized(currentFile.XXX_unrecognized, "", "the file", unknownFileFields)
+	for _, desc := range currentFile.desc {
+		element := "message " + desc.GetName()
+		oneofs := 0
+		for _, rec := range readWireRecords(desc.XXX_unrecognized) {
+			if rec.number != 8 {
+				continue
+			}
+			name := ""
+			for _, field := range readWireRecords(rec.payload) {
+				if field.number == 1 {
+					name = string(field.payload)
+				}
+			}
+			warnLostAt(fmt.Sprintf("%s,%d,%d", desc.path, messageOneofPath, oneofs), "oneof %s of %s is printed as plain fields", name, element)
+			oneofs += 1
+		}
+		warnUnrecognized(desc.XXX_unrecognized, desc.path, element, unknownMessageFields)
+		for i, r := range desc.GetExtensionRange() {
+			warnUnrecognized(r.XXX_unrecognized, fmt.Sprintf("%s,%d,%d", desc.path, messageExtensionRangePath, i), "an extension range of "+element, unknownRangeFields)
+		}
+		for _, field := range append(desc.field, desc.ext...) {
+			warnUnrecognized(field.XXX_unrecognized, field.path, "field "+field.GetName(), unknownFieldFields)
+		}
+		for _, enum := range desc.enum {
+			warnUnrecognizedEnum(enum)
+		}
+	}
+	for _, field := range currentFile.ext {
+		warnUnrecognized(field.XXX_unrecognized, field.path, "extension "+field.GetName(), unknownFieldFields)
+	}
+	for _, enum := range currentFile.enum {
+		warnUnrecognizedEnum(enum)
+	}
+	for _, serv := range currentFile.serv {
+		warnUnrecognized(serv.XXX_unrecognized, serv.path, "service "+serv.GetName(), nil)
+		for i, method := range serv.GetMethod() {
+			warnUnrecognized(method.XXX_unrecognized, fmt.Sprintf("%s,%d,%d", serv.path, methodDescriptorPath, i), "rpc "+method.GetName(), unknownMethodFields)
+		}
+	}
+}
+
+func warnUnrecognizedEnum(enum *EnumDescriptor) {
+	warnUnrecognized(enum.XXX_unrecognized, enum.path, "enum "+enum.GetName(), unknownEnumFields)
+	for i, value := range enum.GetValue() {
+		warnUnrecognized(value.XXX_unrecognized, fmt.Sprintf("%s,%d,%d", enum.path, enumValuePath, i), "enum value "+value.GetName(), nil)
+	}
+}
+
+// warnUnrecognized records a warning for each unrecognized field of the
+// declaration at the given path.
+func warnUnrecognized(b []byte, path string, element string, names map[int32]string) {
+	seen := make(map[int32]bool)
+	for _, rec := range readWireRecords(b) {
+		what, ok := names[rec.number]
+		if seen[rec.number] || (ok && len(what) == 0) {
+			continue
+		}
+		seen[rec.number] = true
+		if !ok {
+			what = fmt.Sprintf("field %d", rec.number)
+		}
+		fieldPath := strings.TrimPrefix(fmt.Sprintf("%s,%d", path, rec.number), ",")
+		if _, ok := currentFile.locations[fieldPath]; !ok {
+			fieldPath = path
+		}
+		warnLostAt(fieldPath, "%s has %s, which the formatter does not support and drops", element, what)
+	}
+}
+
+func newWarning(loc *SourceCodeInfo_Location, format string, args ...interface{}) Warning {
+	w := Warning{File: currentFile.GetName(), Message: fmt.Sprintf(format, args...)}
+	if loc != nil && len(loc.GetSpan()) >= 3 {
+		w.Line = int(loc.GetSpan()[0]) + 1
+		w.Column = int(loc.GetSpan()[1]) + 1
+	}
+	return w
+}
+
+var sources = make(map[string][]byte)
+
+// RegisterSource makes the contents of a .proto file available to the
+// formatter under the name protoc reported for it.  Files that are not
+// registered are read from disk by that name when they are needed.
+func RegisterSource(filename string, content []byte) {
+	sources[filename] = content
+}
+
+// sourceLines returns the lines of the file being formatted, or nil if its
+// source is not available.
+func sourceLines() []string {
+	content, ok := sources[currentFile.GetName()]
+	if !ok {
+		var err error
+		if content, err = ioutil.ReadFile(currentFile.GetName()); err != nil {
+			return nil
+		}
+		sources[currentFile.GetName()] = content
+	}
+	return strings.Split(string(content), "\n")
+}
+
+// spanText returns the source text covered by the location of the given path.
+func spanText(path string) (string, bool) {
+	loc, ok := currentFile.locations[path]
+	if !ok || len(loc.GetSpan()) < 3 {
+		return "", false
+	}
+	lines := sourceLines()
+	span := loc.GetSpan()
+	startLine, startCol, endLine, endCol := span[0], span[1], span[0], span[2]
+	if len(span) == 4 {
+		endLine, endCol = span[2], span[3]
+	}
+	if int(endLine) >= len(lines) {
+		return "", false
+	}
+
+	var s []string
+	for l := startLine; l <= endLine; l++ {
+		line := lines[l]
+		from, to := 0, len(line)
+		if l == startLine {
+			from = columnOffset(line, startCol)
+		}
+		if l == endLine {
+			to = columnOffset(line, endCol)
+		}
+		if from > to {
+			return "", false
+		}
+		s = append(s, line[from:to])
+	}
+	return strings.Join(s, "\n"), true
+}
+
+// columnOffset converts a protoc column, which advances tabs to the next
+// multiple of 8, into a byte offset within the line.
+func columnOffset(line string, column int32) int {
+	col := int32(0)
+	for i := 0; i < len(line); i++ {
+		if col >= column {
+			return i
+		}
+		if line[i] == '\t' {
+			col += 8 - col%8
+		} else {
+			col += 1
+		}
+	}
+	return len(line)
+}
@@ -27,7 +27,6 @@ package descriptor
 
 import (
 	"fmt"
-	"strconv"
 	"strings"
 )
 
@@ -41,6 +40,9 @@ const (
 	extendPath  = 7 // extensions
 	optionsPath = 8 // options
 
+	publicImportPath = 10 // public_dependency
+	weakImportPath   = 11 // weak_dependency
+
 	// tag numbers for options
 	javaPackagePath               = 1
 	JavaOuterClassnamePath        = 2
@@ -56,6 +58,10 @@ const (
 	messageExtensionRangePath = 5
 	messageExtensionPath      = 6
 	messageOptionsPath        = 7
+	messageOneofPath          = 8
+
+	// tag numbers in FieldDescriptorProto
+	fieldOptionsPath = 8
 
 	// tag numbers in EnumDescriptorProto
 	enumValuePath        = 2 // value
@@ -98,6 +104,7 @@ type FieldDescriptor struct {
 	common
 	*FieldDescriptorProto
 	parent *Descriptor // The containing message, if any.
+	path   string      // The SourceCodeInfo path as comma-separated integers.
 }
 
 type ImportedDescriptor struct {
@@ -126,6 +133,9 @@ type FileDescriptor struct {
 
 	// Comments, stored as a map of path (comma-separated integers) to the comment.
 	comments map[string]*SourceCodeInfo_Location
+
+	// All source locations, stored as a map of path to the first location with that path.
+	locations map[string]*SourceCodeInfo_Location
 }
 
 func WrapTypes(set *FileDescriptorSet) {
@@ -150,6 +160,20 @@ func WrapTypes(set *FileDescriptorSet) {
 	}
 }
 
+// WrapFile wraps the types of the set, like the formatter does, and returns
+// the file with the given name, or nil if the set has no such file.
+func (this *FileDescriptorSet) WrapFile(fileName string) *FileDescriptor {
+	allFiles = make([]*FileDescriptor, len(this.File))
+	WrapTypes(this)
+	buildSymbols(allFiles)
+	for _, file := range allFiles {
+		if file.GetName() == fileName {
+			return file
+		}
+	}
+	return nil
+}
+
 // Scan the descriptors in this file.  For each one, build the slice of nested descriptors
 func buildNestedDescriptors(descs []*Descriptor) {
 	for _, desc := range descs {
@@ -181,12 +205,12 @@ func newDescriptor(desc *DescriptorProto, parent *Descriptor, file *FileDescript
 
 	d.ext = make([]*FieldDescriptor, len(desc.Extension))
 	for i, field := range desc.Extension {
-		d.ext[i] = &FieldDescriptor{common{file}, field, d}
+		d.ext[i] = &FieldDescriptor{common{file}, field, d, fmt.Sprintf("%s,%d,%d", d.path, messageExtensionPath, i)}
 	}
 
 	d.field = make([]*FieldDescriptor, len(desc.Field))
 	for i, field := range desc.Field {
-		d.field[i] = &FieldDescriptor{common{file}, field, d}
+		d.field[i] = &FieldDescriptor{common{file}, field, d, fmt.Sprintf("%s,%d,%d", d.path, messageFieldPath, i)}
 	}
 
 	// Enums within messages. Enums within embedded messages appear in the outer-most message.
@@ -246,7 +270,7 @@ func wrapEnumDescriptors(file *FileDescriptorProto, descs []*Descriptor) []*Enum
 func wrapExtensions(file *FileDescriptorProto) []*FieldDescriptor {
 	sl := make([]*FieldDescriptor, len(file.Extension))
 	for i, field := range file.Extension {
-		sl[i] = &FieldDescriptor{common{file}, field, nil}
+		sl[i] = &FieldDescriptor{common{file}, field, nil, fmt.Sprintf("%d,%d", extendPath, i)}
 	}
 	return sl
 }
@@ -279,18 +303,29 @@ func wrapFileOptionsDescriptor(file *FileDescriptorProto) *FileOptionsDescriptor
 	return fod
 }
 
+// Returns the first location of every path of the file, keyed by the path as
+// comma-separated integers.
+func firstLocations(file *FileDescriptorProto) map[string]*SourceCodeInfo_Location {
+	locations := make(map[string]*SourceCodeInfo_Location)
+	for _, loc := range file.GetSourceCodeInfo().GetLocation() {
+		key := Path(loc.Path).String()
+		if _, ok := locations[key]; !ok {
+			locations[key] = loc
+		}
+	}
+	return locations
+}
+
 func extractComments(file *FileDescriptor) {
 	file.comments = make(map[string]*SourceCodeInfo_Location)
+	file.locations = firstLocations(file.FileDescriptorProto)
 	for _, loc := range file.GetSourceCodeInfo().GetLocation() {
+		key := Path(loc.Path).String()
+
 		if loc.LeadingComments == nil && loc.TrailingComments == nil {
 			continue
 		}
 		//fmt.Println(loc.GoString())
-		var p []string
-		for _, n := range loc.Path {
-			p = append(p, strconv.Itoa(int(n)))
-		}
-		key := strings.Join(p, ",")
 
 		// Comment already exists
 		if _, ok := file.comments[key]; ok {
@@ -328,7 +363,9 @@ func LeadingComments(path string, depth int) string {
 	var s []string
 	strCol := strings.Split(text, "\n")
 	s = append(s, "\n")
-	if len(strCol) == 1 {
+	if currentStyle.NormalizeComments {
+		s = append(s, normalizedComment(text, depth))
+	} else if len(strCol) == 1 {
 		// Single line comments
 		s = append(s, getIndentation(depth))
 		s = append(s, "// ")
@@ -374,6 +411,8 @@ func TrailingComments(path string, depth int) string {
 		s = append(s, "// ")
 		s = append(s, strings.TrimSuffix(strings.TrimPrefix(strCol[0], " "), " "))
 		s = append(s, "\n")
+	} else if currentStyle.NormalizeComments {
+		s = append(s, normalizedComment(text, depth))
 	} else {
 		// Multi-line comments
 		if strings.Contains(text, "/*") || strings.Contains(text, "*/") {
@@ -27,11 +27,13 @@ package main
 
 import (
 	proto "code.google.com/p/gogoprotobuf/proto"
+	"fmt"
 	descriptor "github.com/DirkBrand/protobuf-code-formatter/protoc-gen-pretty/descriptor"
 	parser "github.com/DirkBrand/protobuf-code-formatter/protoc-gen-pretty/parser"
 	plugin "github.com/DirkBrand/protobuf-code-formatter/protoc-gen-pretty/plugin"
 	"io/ioutil"
 	"os"
+	"strings"
 )
 
 func main() {
@@ -50,65 +52,146 @@ func main() {
 		if len(Request.GetFileToGenerate()) == 0 {
 			Response.Error = proto.String("No files to generate")
 		}
+		params, err := parseParameters(Request.GetParameter())
+		if err != nil {
+			Response.Error = proto.String(err.Error())
+			params = nil
+		}
 
-		formattedFiles := make(map[string]string)
+		if params != nil {
+			var failures []string
+			Response.File, failures = generate(Request, params)
+			if len(failures) > 0 {
+				Response.Error = proto.String(strings.Join(failures, "\n"))
+			}
+		}
 
-		for _, fileToGen := range Request.GetFileToGenerate() {
-			for _, protoFile := range Request.GetProtoFile() {
-				if protoFile.GetName() == fileToGen {
-					fileSet := descriptor.FileDescriptorSet{Request.GetProtoFile(), nil}
-					formattedFiles[fileToGen] = fileSet.Fmt(fileToGen)
+		// Send back the results.
+		data, err = proto.Marshal(Response)
+		if err != nil {
+			os.Stderr.Write([]byte("failed to marshal output proto"))
+		}
+		_, err = os.Stdout.Write(data)
+		if err != nil {
+			os.Stderr.Write([]byte("failed to write output proto"))
+		}
 
-					if parser.CheckFloatingComments(fileToGen) {
-						os.Stderr.WriteString("You had unattached comments that got lost.\n")
-					}
+	}
+}
 
-					header := parser.ReadFileHeader(fileToGen)
-					if len(header) != 0 {
-						formattedFiles[fileToGen] = header + formattedFiles[fileToGen]
-					}
-					//os.Stderr.WriteString(fmt.Sprintf("%v", formattedFiles[fileToGen]))
+// Formats the files to generate of the request, and returns the files to
+// write and the reasons the others failed.
+func generate(request *plugin.CodeGeneratorRequest, params *parameters) ([]*plugin.CodeGeneratorResponse_File, []string) {
+	var files []*plugin.CodeGeneratorResponse_File
+	var failures []string
+	for _, fileToGen := range request.GetFileToGenerate() {
+		formatted, warnings, err := formatFile(request, fileToGen, params)
+		for _, w := range warnings {
+			os.Stderr.WriteString(w.String() + "\n")
+		}
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		if params.failOnLoss && hasLoss(warnings) {
+			for _, w := range warnings {
+				if w.Lost {
+					failures = append(failures, w.String())
 				}
 			}
+			continue
 		}
-
-		// Create the slice of response files
-		Response.File = make([]*plugin.CodeGeneratorResponse_File, len(formattedFiles))
-
-		i := 0
-		for fileName, formatFile := range formattedFiles {
-
-			fo, err := os.Create("tempOutput.proto")
+		if params.check {
+			source, err := readSource(fileToGen, params)
 			if err != nil {
-				panic(err)
+				failures = append(failures, fmt.Sprintf("%s: %v", fileToGen, err))
+			} else if !sameContent(string(source), formatted) {
+				failures = append(failures, fileToGen+": not formatted")
 			}
-			defer os.Remove("tempOutput.proto")
-			fo.WriteString(formatFile)
-			fo.Close()
-
-			_, err2 := parser.ParseFile("tempOutput.proto", "./", "../../../")
-			if err2 != nil {
-				Response.Error = proto.String(err2.Error())
-			} else {
-				Response.File[i] = new(plugin.CodeGeneratorResponse_File)
+			continue
+		}
 
-				Response.File[i].Name = proto.String(fileName)
-				Response.File[i].Content = proto.String(formatFile)
+		files = append(files, &plugin.CodeGeneratorResponse_File{
+			Name:    proto.String(params.outputName(fileToGen)),
+			Content: proto.String(formatted),
+		})
+	}
+	return files, failures
+}
 
-				i += 1
+// Formats the file with the given name from the request, and returns the
+// warnings for it. A file that does not parse once formatted is an error.
+func formatFile(request *plugin.CodeGeneratorRequest, fileToGen string, params *parameters) (string, []descriptor.Warning, error) {
+	var original *descriptor.FileDescriptorProto
+	for _, protoFile := range request.GetProtoFile() {
+		if protoFile.GetName() == fileToGen {
+			original = protoFile
+		}
+	}
+	if original == nil {
+		return "", nil, fmt.Errorf("%s: not found in the request", fileToGen)
+	}
 
-			}
+	style, err := params.styleFor(fileToGen)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %v", fileToGen, err)
+	}
+	fileSet := descriptor.FileDescriptorSet{request.GetProtoFile(), nil}
+
+	var header string
+	if source, err := readSource(fileToGen, params); err == nil {
+		descriptor.RegisterSource(fileToGen, source)
+		h := parser.ParseHeader(string(source))
+		if h.Attached {
+			fileSet.DetachHeader(fileToGen)
 		}
+		header = h.Text
+	} else {
+		header = fileSet.FileHeader(fileToGen)
+	}
 
-		// Send back the results.
-		data, err = proto.Marshal(Response)
+	formatted := fileSet.FmtStyle(fileToGen, style)
+	warnings := descriptor.Warnings()
+	if len(header) != 0 {
+		formatted = header + formatted
+	}
+
+	if params.verify {
+		reparsed, err := parser.Reparse(fileToGen, formatted, request.GetProtoFile())
 		if err != nil {
-			os.Stderr.Write([]byte("failed to marshal output proto"))
+			return "", warnings, fmt.Errorf("%s: formatted file does not parse: %v", fileToGen, err)
 		}
-		_, err = os.Stdout.Write(data)
-		if err != nil {
-			os.Stderr.Write([]byte("failed to write output proto"))
+		if style.Simplify && !descriptor.Equivalent(original, reparsed) {
+			return "", warnings, fmt.Errorf("%s: simplified file defines different things", fileToGen)
+		}
+	}
+	return formatted, warnings, nil
+}
+
+// Returns whether any of the warnings is for something the formatted file
+// is missing.
+func hasLoss(warnings []descriptor.Warning) bool {
+	for _, w := range warnings {
+		if w.Lost {
+			return true
 		}
+	}
+	return false
+}
 
+// Reads the source of the file with the given name from the proto_path roots.
+func readSource(fileToGen string, params *parameters) ([]byte, error) {
+	p, ok := params.sourcePath(fileToGen)
+	if !ok && len(params.protoPaths) == 0 {
+		return nil, fmt.Errorf("source not found in the working directory, set proto_path")
+	} else if !ok {
+		return nil, fmt.Errorf("source not found in %s", strings.Join(params.protoPaths, ", "))
 	}
+	return ioutil.ReadFile(p)
+}
+
+// Returns whether the source of a file is the same as its formatted version,
+// ignoring the newlines at the end.
+func sameContent(source, formatted string) bool {
+	return strings.TrimRight(source, "\n") == strings.TrimRight(formatted, "\n")
 }
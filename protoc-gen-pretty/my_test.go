@@ -25,8 +25,14 @@ OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 package main
 
 import (
+	proto "code.google.com/p/gogoprotobuf/proto"
 	"fmt"
+	ast "github.com/DirkBrand/protobuf-code-formatter/protoc-gen-pretty/ast"
+	config "github.com/DirkBrand/protobuf-code-formatter/protoc-gen-pretty/config"
+	descriptor "github.com/DirkBrand/protobuf-code-formatter/protoc-gen-pretty/descriptor"
 	parser "github.com/DirkBrand/protobuf-code-formatter/protoc-gen-pretty/parser"
+	plugin "github.com/DirkBrand/protobuf-code-formatter/protoc-gen-pretty/plugin"
+	rewrite "github.com/DirkBrand/protobuf-code-formatter/protoc-gen-pretty/rewrite"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -115,6 +121,701 @@ func TestCommentedCode(t *testing.T) {
 	parseAndTestFile(t, fileLocation+fileName)
 }
 
+func TestRepeatedOptions(t *testing.T) {
+	fileName := "repeatedOptionsTest.proto"
+	parseAndTestFile(t, fileLocation+fileName)
+}
+
+func TestAggregateOptions(t *testing.T) {
+	fileName := "aggregateOptionsTest.proto"
+	parseAndTestFile(t, fileLocation+fileName)
+}
+
+func TestNestedOptions(t *testing.T) {
+	fileName := "nestedOptionsTest.proto"
+	parseAndTestFile(t, fileLocation+fileName)
+}
+
+func TestBuiltinOptions(t *testing.T) {
+	fileName := "builtinOptionsTest.proto"
+	parseAndTestFile(t, fileLocation+fileName)
+}
+
+func TestNewBuiltinOptions(t *testing.T) {
+	fileName := fileLocation + "newBuiltinOptionsTest.proto"
+	parseAndTestFile(t, fileName)
+
+	d, err := parser.ParseFile(fileName, "./")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Fmt(fileName)
+	if warnings := descriptor.Warnings(); len(warnings) != 6 || hasLoss(warnings) {
+		t.Errorf("Expected a warning for each option printed as written, got %v", warnings)
+	}
+
+	// Without the source the options cannot be printed
+	src, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	descriptor.RegisterSource(fileName, []byte{})
+	defer descriptor.RegisterSource(fileName, src)
+	d.Fmt(fileName)
+	if warnings := descriptor.Warnings(); len(warnings) != 6 || !hasLoss(warnings) {
+		t.Errorf("Expected the dropped options to be reported as lost, got %v", warnings)
+	}
+}
+
+func TestBlankLines(t *testing.T) {
+	fileName := "blankLinesTest.proto"
+	parseAndTestFile(t, fileLocation+fileName)
+}
+
+func TestBlockHeader(t *testing.T) {
+	fileName := "blockHeaderTest.proto"
+	parseAndTestFile(t, fileLocation+fileName)
+}
+
+func TestHeaderTemplate(t *testing.T) {
+	template, err := parser.NewHeaderTemplate("/*\n * Copyright {{year}} Example Ltd.\n */\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "/*\n * Copyright 2014 Example Ltd.\n */\n\n"
+	if header := template.Apply("", false, 2014); header != expected {
+		t.Errorf("Expected the template to be inserted, got %q", header)
+	}
+
+	existing := "// Some other license\n\n"
+	if header := template.Apply(existing, false, 2014); header != existing {
+		t.Errorf("Expected the header to be kept, got %q", header)
+	}
+	if header := template.Apply(existing, true, 2014); header != expected {
+		t.Errorf("Expected the header to be replaced, got %q", header)
+	}
+
+	older := "/*\n * Copyright 2009 Example Ltd.\n */\n\n"
+	if header := template.Apply(older, true, 2014); header != older {
+		t.Errorf("Expected a header from another year to be kept, got %q", header)
+	}
+
+	if _, err := parser.NewHeaderTemplate("// License\npackage a;\n"); err == nil {
+		t.Error("Expected a template with code to be rejected")
+	}
+}
+
+func TestLiterals(t *testing.T) {
+	fileName := "literalsTest.proto"
+	parseAndTestFile(t, fileLocation+fileName)
+}
+
+func TestTypeNames(t *testing.T) {
+	fileName := "typeNamesTest.proto"
+	parseAndTestFile(t, fileLocation+fileName)
+}
+
+func TestQualifiedTypeNames(t *testing.T) {
+	fileName := fileLocation + "typeNamesTest.proto"
+	d, err := parser.ParseFile(fileName, "./")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	style := descriptor.DefaultStyle()
+	style.QualifiedTypeNames = true
+	formattedFile := strings.TrimSpace(d.FmtStyle(fileName, style))
+	goldString, err := ioutil.ReadFile(fileLocation + "typeNamesQualified_Gold.proto")
+	if err != nil {
+		t.Error(err)
+	}
+	if parser.Strcmp(formattedFile, strings.TrimSpace(string(goldString))) != 0 {
+		t.Error("Failed the gold standard with: " + fmt.Sprintf("%v", parser.Strcmp(formattedFile, strings.TrimSpace(string(goldString)))))
+	}
+}
+
+func TestWellKnownTypes(t *testing.T) {
+	parseAndTestFile(t, fileLocation+"wellKnownTypesTest.proto")
+}
+
+func TestStyleConfig(t *testing.T) {
+	parseAndTestConfiguredFile(t, fileLocation+"style/source/styleTest.proto")
+
+	if err := config.Parse("bad.yaml", []byte("indent: 4\nsemicolons: false\n"), descriptor.DefaultStyle()); err == nil {
+		t.Error("Expected an error for an unknown setting")
+	}
+
+	style := descriptor.DefaultStyle()
+	if err := config.Parse("quoted.yaml", []byte("indent: \"2\" # Two spaces\n"), style); err != nil || style.IndentWidth != 2 {
+		t.Errorf("Expected the comment after the quoted value to be ignored, got %v", err)
+	}
+	err := config.Parse("quoted.yaml", []byte("option_order: \"#name\" # Not a comment inside quotes\n"), style)
+	if err == nil || !strings.Contains(err.Error(), `"#name"`) {
+		t.Errorf("Expected the quoted value to be kept whole, got %v", err)
+	}
+}
+
+func TestAlign(t *testing.T) {
+	parseAndTestConfiguredFile(t, fileLocation+"align/alignTest.proto")
+}
+
+func TestMaxLineWidth(t *testing.T) {
+	parseAndTestConfiguredFile(t, fileLocation+"wrap/wrapTest.proto")
+}
+
+func TestAlignWrapped(t *testing.T) {
+	parseAndTestConfiguredFile(t, fileLocation+"wrapAlign/wrapAlignTest.proto")
+}
+
+func TestNormalizeComments(t *testing.T) {
+	parseAndTestConfiguredFile(t, fileLocation+"comments/commentsTest.proto")
+}
+
+func TestSort(t *testing.T) {
+	parseAndTestConfiguredFile(t, fileLocation+"sort/sortTest.proto")
+}
+
+func TestSimplify(t *testing.T) {
+	parseAndTestConfiguredFile(t, fileLocation+"simplify/simplifyTest.proto")
+}
+
+func TestRewrite(t *testing.T) {
+	filename := fileLocation + "rewrite/rewriteTest.proto"
+	d, err := parser.ParseFile(filename, "./")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rules []*rewrite.Rule
+	for _, r := range []string{
+		`"testdata/rewrite/oldOptions.proto" -> "testdata/rewrite/newOptions.proto"`,
+		`(old.sensitive) -> (new.sensitive)`,
+		`int32 user_id -> int64 user_id`,
+		`Account owner -> User owner`,
+		`int32 limit -> int64 limit`,
+		`int32 user_ref -> int64 uid`,
+		`int32 count -> int32 total`,
+	} {
+		rule, err := rewrite.Parse(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, rule)
+	}
+	defer descriptor.RenameOptions(nil)
+	if n, err := rewrite.Apply(d, filename, rules); err != nil {
+		t.Fatal(err)
+	} else if n != 6 {
+		t.Errorf("%d changes instead of 6", n)
+	}
+
+	// Rules that make a default or an option invalid change nothing
+	for _, r := range []string{"string mode -> int64 mode", "int32 ids -> string ids"} {
+		rule, err := rewrite.Parse(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := rewrite.Apply(d, filename, []*rewrite.Rule{rule}); err == nil {
+			t.Errorf("%q made %d changes instead of failing", r, n)
+		}
+	}
+
+	formattedFile := strings.TrimSpace(d.Fmt(filename))
+	goldFile := strings.Replace(filename, ".proto", "_Gold.proto", 1)
+	goldString, err := ioutil.ReadFile(goldFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parser.Strcmp(formattedFile, strings.TrimSpace(string(goldString))) != 0 {
+		t.Error("Failed the gold standard with: " + fmt.Sprintf("%v", parser.Strcmp(formattedFile, strings.TrimSpace(string(goldString)))))
+	}
+	// The rewritten file imports what it uses and compiles
+	imports, err := parser.ParseFile(goldFile, "./")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.Reparse(filename, formattedFile, imports.GetFile()); err != nil {
+		t.Error(err)
+	}
+
+	for _, r := range []string{"int32 user_id", "(a) -> \"b.proto\"", "int32 * -> int64 user_id -> x", "int32 id -> int64 *"} {
+		if _, err := rewrite.Parse(r); err == nil {
+			t.Errorf("%q parsed as a rule", r)
+		}
+	}
+}
+
+func TestEdit(t *testing.T) {
+	filename := fileLocation + "edit/editTest.proto"
+	d, err := parser.ParseFile(filename, "./")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := d.Edit(filename)
+	if file == nil {
+		t.Fatal(filename + " is not in the set")
+	}
+
+	check := func(err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(file.RemoveImport("testdata/edit/editOld.proto"))
+	check(file.AddImport("testdata/edit/editExtra.proto"))
+	check(file.SetOption("optimize_for", "LITE_RUNTIME"))
+	check(file.SetOption("(defs.owner)", `'\x61cc\157unts'`))
+	check(file.AddOption("(defs.aliases)", `"\101\x64mins"`))
+	check(file.AddOption("(defs.aliases)", `'members'`))
+
+	account := file.LookupMessage("Account")
+	check(account.RemoveField("nickname"))
+	email := account.LookupField("email")
+	check(email.Deprecate())
+	check(email.SetOption("(defs.sensitive)", "true"))
+	check(account.LookupField("phone_no").Rename("phone"))
+	check(account.LookupField("kind").Rename("account_kind"))
+	_, err = account.AddField(&descriptor.FieldDescriptorProto{Name: proto.String("created"), Number: proto.Int32(5), TypeName: proto.String("extra.Audit")})
+	check(err)
+	check(account.SetOption("(defs.tier)", "PAID"))
+
+	kind := file.LookupEnum("Account.Kind")
+	check(kind.RenameValue("BASIC", "STANDARD"))
+	check(kind.RemoveValue("GOLD"))
+	check(kind.AddValue("DIAMOND", 3))
+	check(account.Rename("User"))
+
+	service := file.LookupService("Accounts")
+	check(service.RenameMethod("Find", "FindUser"))
+	check(service.AddMethod(&descriptor.MethodDescriptorProto{Name: proto.String("History"), InputType: proto.String("User"), OutputType: proto.String("extra.Audit")}))
+	check(service.SetMethodOption("History", "(defs.timeout_ms)", "-0x10"))
+
+	page, err := file.AddMessage(&descriptor.DescriptorProto{
+		Name: proto.String("Page"),
+		Field: []*descriptor.FieldDescriptorProto{
+			{Name: proto.String("first"), Number: proto.Int32(1), TypeName: proto.String("User")},
+			{Name: proto.String("size"), Number: proto.Int32(2), Type: descriptor.FieldDescriptorProto_TYPE_INT32.Enum()},
+		},
+	})
+	check(err)
+
+	// Mistakes are reported and change nothing
+	if _, err := page.AddField(&descriptor.FieldDescriptorProto{Name: proto.String("count"), Number: proto.Int32(2), Type: descriptor.FieldDescriptorProto_TYPE_INT32.Enum()}); err == nil {
+		t.Error("a field number was used twice")
+	}
+	method := &descriptor.MethodDescriptorProto{Name: proto.String("Purge"), InputType: proto.String("User"), OutputType: proto.String("Missing")}
+	if err := service.AddMethod(method); err == nil || method.GetInputType() != "User" {
+		t.Errorf("a method with an unknown type was added or changed: %v", method)
+	}
+	field := &descriptor.FieldDescriptorProto{Name: proto.String("missing"), Number: proto.Int32(3), TypeName: proto.String("Missing")}
+	if _, err := page.AddField(field); err == nil || field.Label != nil {
+		t.Errorf("a field with an unknown type was added or changed: %v", field)
+	}
+	if err := page.Rename("User"); err == nil {
+		t.Error("a message was renamed to the name of another")
+	}
+	if err := file.SetOption("(defs.sensitive)", "true"); err == nil {
+		t.Error("a field option was set on the file")
+	}
+	if err := file.AddOption("(defs.owner)", `"admins"`); err == nil {
+		t.Error("a value was added to an option that is not repeated")
+	}
+	for _, value := range []string{"0b101", "0o7", "1_000", "08", "0x", "+1"} {
+		if err := service.SetMethodOption("History", "(defs.timeout_ms)", value); err == nil {
+			t.Errorf("%s was read as an integer", value)
+		}
+	}
+	for _, value := range []string{`"\q"`, `"\x"`, `"\u12"`, `'it's'`} {
+		if err := file.SetOption("(defs.owner)", value); err == nil {
+			t.Errorf("%s was read as a string", value)
+		}
+	}
+	if file.LookupMessage("Account") != nil {
+		t.Error("the old name of a message was found")
+	}
+	check(file.RemoveMessage("Page"))
+	if err := page.SetOption("deprecated", "true"); err == nil {
+		t.Error("a removed message was changed")
+	}
+
+	formattedFile := strings.TrimSpace(d.Fmt(filename))
+	goldFile := strings.Replace(filename, ".proto", "_Gold.proto", 1)
+	goldString, err := ioutil.ReadFile(goldFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parser.Strcmp(formattedFile, strings.TrimSpace(string(goldString))) != 0 {
+		t.Error("Failed the gold standard with: " + fmt.Sprintf("%v", parser.Strcmp(formattedFile, strings.TrimSpace(string(goldString)))))
+	}
+	if _, err := parser.ParseFile(goldFile, "./"); err != nil {
+		t.Error(err)
+	}
+}
+
+// Records every element it visits, but does not walk into enums.
+type walkRecorder struct {
+	descriptor.BaseVisitor
+	visited []string
+}
+
+func (this *walkRecorder) record(kind string, element *descriptor.Element) {
+	var parents []string
+	for parent := element.Parent; parent != nil; parent = parent.Parent {
+		parents = append(parents, parent.Name)
+	}
+	line := fmt.Sprintf("%s %s %v %v %q %q %q", kind, element.Name, element.Path, parents, element.Leading, element.Trailing, element.Detached)
+	this.visited = append(this.visited, line)
+}
+
+func (this *walkRecorder) VisitMessage(message *descriptor.Descriptor, element *descriptor.Element) bool {
+	this.record("message", element)
+	return true
+}
+
+func (this *walkRecorder) VisitField(field *descriptor.FieldDescriptor, element *descriptor.Element) {
+	this.record("field", element)
+}
+
+func (this *walkRecorder) VisitExtension(extension *descriptor.FieldDescriptor, element *descriptor.Element) {
+	this.record("extension", element)
+}
+
+func (this *walkRecorder) VisitEnum(enum *descriptor.EnumDescriptor, element *descriptor.Element) bool {
+	this.record("enum", element)
+	return enum.GetName() != "Unit"
+}
+
+func (this *walkRecorder) VisitEnumValue(value *descriptor.EnumValueDescriptorProto, element *descriptor.Element) {
+	this.record("value", element)
+}
+
+func (this *walkRecorder) VisitMethod(method *descriptor.MethodDescriptorProto, element *descriptor.Element) {
+	this.record("method", element)
+}
+
+func TestWalk(t *testing.T) {
+	filename := fileLocation + "walk/walkTest.proto"
+	d, err := parser.ParseFile(filename, "./")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &walkRecorder{}
+	descriptor.Walk(d.WrapFile(filename), v)
+
+	expected := []string{
+		`message .walk.Point 4,0 [] " A point on the map.\n" "" []`,
+		`field .walk.Point.x 4,0,2,0 [.walk.Point] "" " Across\n" []`,
+		`field .walk.Point.y 4,0,2,1 [.walk.Point] "" "" []`,
+		`message .walk.Point.Label 4,0,3,0 [.walk.Point] " Where the name goes.\n" "" [" Detached from Label\n"]`,
+		`field .walk.Point.Label.text 4,0,3,0,2,0 [.walk.Point.Label .walk.Point] "" "" []`,
+		`field .walk.Point.Label.style 4,0,3,0,2,1 [.walk.Point.Label .walk.Point] "" "" []`,
+		`message .walk.Point.Label.Style 4,0,3,0,3,0 [.walk.Point.Label .walk.Point] "" "" []`,
+		`field .walk.Point.Label.Style.bold 4,0,3,0,3,0,2,0 [.walk.Point.Label.Style .walk.Point.Label .walk.Point] "" "" []`,
+		`enum .walk.Point.Kind 4,0,4,0 [.walk.Point] "" "" []`,
+		`value .walk.Point.CITY 4,0,4,0,2,0 [.walk.Point.Kind .walk.Point] "" "" []`,
+		`value .walk.Point.PEAK 4,0,4,0,2,1 [.walk.Point.Kind .walk.Point] " A mountain top.\n" "" []`,
+		`extension .walk.Point.origin 4,0,6,0 [.walk.Point] "" "" []`,
+		`enum .walk.Unit 5,0 [] "" "" []`,
+		`extension .walk.unit 7,0 [] "" "" []`,
+		`method .walk.Maps.Nearest 6,0,2,0 [.walk.Maps] " Finds the nearest point.\n" "" []`,
+	}
+	if strings.Join(v.visited, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("visited\n%s\ninstead of\n%s", strings.Join(v.visited, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestLocation(t *testing.T) {
+	filename := fileLocation + "location/locationTest.proto"
+	d, err := parser.ParseFile(filename, "./")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := d.WrapFile(filename)
+	sample := file.LookupMessage("Sample")
+	value := sample.LookupField("value")
+	scale := file.LookupEnum("Sample.Scale")
+	service := file.LookupService("Samples")
+
+	optionPath := func(element descriptor.Path, name string) descriptor.Path {
+		path, err := file.OptionPath(element, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	for _, c := range []struct {
+		path     descriptor.Path
+		expected string
+	}{
+		{sample.Path(), "10:1-20:2"},
+		{value.Path(), "13:3-13:63"},
+		// Tabs count up to the next multiple of 8
+		{scale.Path(), "16:9-19:4"},
+		{scale.ValuePath("LOG"), "18:5-18:13"},
+		{service.MethodPath("Get"), "23:3-23:37"},
+		{optionPath(sample.Path(), "no_standard_descriptor_accessor"), "11:3-11:49"},
+		{optionPath(value.Path(), "(unit)"), "13:30-13:42"},
+		{optionPath(value.Path(), "deprecated"), "13:44-13:61"},
+	} {
+		loc, ok := file.Location(c.path)
+		if !ok {
+			t.Errorf("no location for %v", c.path)
+		} else if span := fmt.Sprintf("%d:%d-%d:%d", loc.StartLine, loc.StartColumn, loc.EndLine, loc.EndColumn); span != c.expected {
+			t.Errorf("%v is at %s instead of %s", c.path, span, c.expected)
+		}
+	}
+
+	if loc, _ := value.Location(); loc.String() != "testdata/location/locationTest.proto:13:3" {
+		t.Errorf("value is at %v", loc)
+	}
+	// Options that are not set have a path, but no location
+	if _, ok := file.Location(optionPath(nil, "java_package")); ok {
+		t.Error("java_package has a location")
+	}
+	if _, err := file.OptionPath(descriptor.Path{4, 0, 3}, "deprecated"); err == nil {
+		t.Error("an option of a list was found")
+	}
+	if _, err := file.OptionPath(service.Path(), "(unit)"); err == nil {
+		t.Error("a field option was found on a service")
+	}
+}
+
+func TestAST(t *testing.T) {
+	filename := fileLocation + "ast/astTest.proto"
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := ast.Parse(filename, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	formattedFile := file.Fmt()
+	goldFile := strings.Replace(filename, ".proto", "_Gold.proto", 1)
+	goldString, err := ioutil.ReadFile(goldFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parser.Strcmp(formattedFile, string(goldString)) != 0 {
+		t.Error("Failed the gold standard with: " + fmt.Sprintf("%v", parser.Strcmp(formattedFile, string(goldString))))
+	}
+	if _, err := parser.ParseFile(goldFile, "./"); err != nil {
+		t.Error(err)
+	}
+
+	// Printing is stable
+	gold, err := ast.Parse(goldFile, goldString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gold.Fmt() != string(goldString) {
+		t.Error("The gold standard does not print as itself")
+	}
+
+	// Positions and comments
+	for _, decl := range file.Decls {
+		if m, ok := decl.(*ast.Message); ok {
+			if m.Start().Line != 16 || m.Start().Column != 1 || m.End().Line != 42 || m.End().Column != 2 {
+				t.Errorf("message %s at %v to %v", m.Name, m.Start(), m.End())
+			}
+			if m.Leading == nil || m.Leading.Text() != "A message\nwith two styles of comments" {
+				t.Errorf("leading comments of message %s: %v", m.Name, m.Leading)
+			}
+			if m.OpenComment == nil || m.OpenComment.Text() != "after the brace" {
+				t.Errorf("comment after the brace of message %s: %v", m.Name, m.OpenComment)
+			}
+		}
+	}
+	if len(file.Comments) != 11 {
+		t.Errorf("%d comment groups instead of 11", len(file.Comments))
+	}
+
+	if _, err := ast.Parse("broken.proto", []byte("message A {\n  optional int32 a = ;\n}\n")); err == nil || err.Error() != `broken.proto:2:22: expected a number, found ";"` {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestPluginParameters(t *testing.T) {
+	params, err := parseParameters("indent=4, order=source,verify=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.verify {
+		t.Error("Expected verify to be turned off")
+	}
+	style, err := params.styleFor(fileLocation + "sample.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if style.IndentWidth != 4 || style.OptionOrder != descriptor.OptionOrderSource {
+		t.Errorf("Parameters were not applied to the style: %+v", style)
+	}
+
+	for _, bad := range []string{"indent=wide", "colour=blue", "verify", "verify=maybe"} {
+		if _, err := parseParameters(bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestPluginOutputNames(t *testing.T) {
+	cases := map[string]string{
+		"":                                "a/b.proto",
+		"suffix=.formatted.proto":         "a/b.formatted.proto",
+		"mirror=true":                     "formatted/a/b.proto",
+		"mirror_root=pretty/,suffix=.txt": "pretty/a/b.txt",
+		"mirror_root=pretty,mirror=false": "a/b.proto",
+	}
+	for parameter, expected := range cases {
+		params, err := parseParameters(parameter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name := params.outputName("a/b.proto"); name != expected {
+			t.Errorf("%q: expected %s, got %s", parameter, expected, name)
+		}
+	}
+
+	for _, bad := range []string{"mirror_root=/tmp", "mirror_root=../up", "suffix=a/b", "check=sometimes"} {
+		if _, err := parseParameters(bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestFileHeaderFromSourceInfo(t *testing.T) {
+	for _, fileName := range []string{"fieldOptionsTest.proto", "descriptor.proto", "sample.proto"} {
+		d, err := parser.ParseFile(fileLocation+fileName, "./")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := parser.ReadFileHeader(fileLocation + fileName)
+		if header := d.FileHeader(fileLocation + fileName); header != expected {
+			t.Errorf("%s: expected header %q, got %q", fileName, expected, header)
+		}
+	}
+
+	params, err := parseParameters("proto_path=missing,proto_path=testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := params.sourcePath("sample.proto"); !ok || p != fileLocation+"sample.proto" {
+		t.Errorf("Expected sample.proto to be found in testdata, got %q", p)
+	}
+	if _, ok := params.sourcePath("nothing.proto"); ok {
+		t.Error("Expected nothing.proto not to be found")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	fileName := fileLocation + "typeNamesTest.proto"
+	d, err := parser.ParseFile(fileName, "./")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The imports come from the descriptors only, not the working directory
+	formattedFile := d.Fmt(fileName)
+	if err := parser.Validate(fileName, formattedFile, d.GetFile()); err != nil {
+		t.Error(err)
+	}
+	if err := parser.Validate(fileName, formattedFile+"\nmessage {", d.GetFile()); err == nil {
+		t.Error("Expected the broken file to be rejected")
+	}
+}
+
+func TestDetachedCommentsReported(t *testing.T) {
+	fileName := fileLocation + "detachedCommentsTest.proto"
+	d, err := parser.ParseFile(fileName, "./")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.Fmt(fileName)
+	warnings := descriptor.Warnings()
+	if len(warnings) != 1 || !warnings[0].Lost || warnings[0].Line != 5 {
+		t.Errorf("Expected the lost comment to be reported above line 5, got %v", warnings)
+	}
+	if !hasLoss(warnings) {
+		t.Error("Expected the warnings to report a loss")
+	}
+}
+
+func TestFailOnLoss(t *testing.T) {
+	params, err := parseParameters("fail_on_loss=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Oneofs and reserved names are not printed
+	fileName := fileLocation + "lossTest.proto"
+	d, err := parser.ParseFile(fileName, "./")
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := &plugin.CodeGeneratorRequest{FileToGenerate: []string{fileName}, ProtoFile: d.GetFile()}
+	if files, failures := generate(request, params); len(files) != 0 || len(failures) != 3 {
+		t.Errorf("Expected the oneof and the reserved ranges and names to fail the file, got %v", failures)
+	}
+
+	// Options that are not defined and cannot be read from the source are
+	// dropped. Without the file defining them the result cannot be verified.
+	if params, err = parseParameters("fail_on_loss=true,verify=false,proto_path=missing"); err != nil {
+		t.Fatal(err)
+	}
+	fileName = fileLocation + "unknownOptionsTest.proto"
+	if d, err = parser.ParseFile(fileName, "./"); err != nil {
+		t.Fatal(err)
+	}
+	var files []*descriptor.FileDescriptorProto
+	for _, file := range d.GetFile() {
+		if file.GetName() != fileLocation+"unknownOptionsDefs.proto" {
+			files = append(files, file)
+		}
+	}
+	src, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	descriptor.RegisterSource(fileName, []byte{})
+	defer descriptor.RegisterSource(fileName, src)
+	request = &plugin.CodeGeneratorRequest{FileToGenerate: []string{fileName}, ProtoFile: files}
+	if files, failures := generate(request, params); len(files) != 0 || !strings.Contains(strings.Join(failures, "\n"), "was dropped") {
+		t.Errorf("Expected the dropped options to fail the file, got %v", failures)
+	}
+}
+
+func TestUnknownOptions(t *testing.T) {
+	fileName := fileLocation + "unknownOptionsTest.proto"
+	d, err := parser.ParseFile(fileName, "./")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Leave out the file defining the options, as if it was not on the proto path
+	var files []*descriptor.FileDescriptorProto
+	for _, file := range d.GetFile() {
+		if file.GetName() != fileLocation+"unknownOptionsDefs.proto" {
+			files = append(files, file)
+		}
+	}
+	d.File = files
+
+	formattedFile := strings.TrimSpace(d.Fmt(fileName))
+	goldString, err := ioutil.ReadFile(fileLocation + "unknownOptionsTest_Gold.proto")
+	if err != nil {
+		t.Error(err)
+	}
+	if parser.Strcmp(formattedFile, strings.TrimSpace(string(goldString))) != 0 {
+		t.Error("Failed the gold standard with: " + fmt.Sprintf("%v", parser.Strcmp(formattedFile, strings.TrimSpace(string(goldString)))))
+	}
+
+	if len(descriptor.Warnings()) != 3 {
+		t.Errorf("Expected a warning for each unknown option, got %v", descriptor.Warnings())
+	}
+}
+
 // Negative Tests
 func TestExtendCommentLimitation(t *testing.T) {
 	fileName := "extendCommentsLimitationTest.proto"
@@ -131,6 +832,37 @@ func TestUnattachedCommentsLostLimitation(t *testing.T) {
 	parseAndTestFile(t, fileLocation+fileName)
 }
 
+// Formats the file in the style of the configuration files around it
+func parseAndTestConfiguredFile(t *testing.T, filename string) {
+	d, err := parser.ParseFile(filename, "./")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	style, err := config.ForFile(filename, descriptor.DefaultStyle())
+	if err != nil {
+		t.Fatal(err)
+	}
+	formattedFile := strings.TrimSpace(d.FmtStyle(filename, style))
+	// Whatever the style, the file must still define the same things
+	if reparsed, err := parser.Reparse(filename, formattedFile, d.GetFile()); err != nil {
+		t.Error(err)
+	} else {
+		for _, file := range d.GetFile() {
+			if file.GetName() == filename && !descriptor.Equivalent(file, reparsed) {
+				t.Error(filename + ": the formatted file defines different things")
+			}
+		}
+	}
+	goldString, err := ioutil.ReadFile(strings.Replace(filename, ".proto", "_Gold.proto", 1))
+	if err != nil {
+		t.Error(err)
+	}
+	if parser.Strcmp(formattedFile, strings.TrimSpace(string(goldString))) != 0 {
+		t.Error("Failed the gold standard with: " + fmt.Sprintf("%v", parser.Strcmp(formattedFile, strings.TrimSpace(string(goldString)))))
+	}
+}
+
 func parseAndTestFile(t *testing.T, filename string) {
 	parser.FixFloatingComments(filename)
 
@@ -140,12 +872,19 @@ func parseAndTestFile(t *testing.T, filename string) {
 		os.Exit(1)
 	} else {
 
-		header := parser.ReadFileHeader(filename)
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := parser.ParseHeader(string(src))
+		if header.Attached {
+			d.DetachHeader(filename)
+		}
 
 		formattedFile := d.Fmt(filename)
 		formattedFile = strings.TrimSpace(formattedFile)
-		if len(header) != 0 {
-			formattedFile = header + formattedFile
+		if len(header.Text) != 0 {
+			formattedFile = header.Text + formattedFile
 		}
 
 		// Test if formatted file can be parsed
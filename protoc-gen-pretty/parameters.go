@@ -0,0 +1,189 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package main
+
+import (
+	"fmt"
+	config "github.com/DirkBrand/protobuf-code-formatter/protoc-gen-pretty/config"
+	descriptor "github.com/DirkBrand/protobuf-code-formatter/protoc-gen-pretty/descriptor"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A style setting given as a parameter, applied on top of the configuration
+// files of every file to format.
+type setting struct {
+	key   string
+	value string
+}
+
+// The settings passed to the plugin, as in --pretty_out=indent=4,verify=true:outdir
+type parameters struct {
+	style []setting
+	// Re-parse the formatted files before returning them
+	verify bool
+	// Fail instead of returning a file that is missing comments or options
+	failOnLoss bool
+	// Replaces the .proto extension of the output files
+	suffix string
+	// Writes the output files below this directory, if set
+	mirrorRoot string
+	// Only report the files that are not formatted, write nothing
+	check bool
+	// The roots the sources are found in, as given to protoc with -I
+	protoPaths []string
+}
+
+// The directory of the output files if mirror=true is given without a
+// mirror_root
+const defaultMirrorRoot = "formatted"
+
+// Parses the comma-separated list of key=value pairs protoc passes to the
+// plugin. Style settings are checked against a default style straight away,
+// so that a bad value is reported once instead of for every file.
+func parseParameters(parameter string) (*parameters, error) {
+	params := &parameters{verify: true}
+	check := descriptor.DefaultStyle()
+
+	for _, pair := range strings.Split(parameter, ",") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+			continue
+		}
+		ind := strings.Index(pair, "=")
+		if ind < 0 {
+			return nil, fmt.Errorf("parameter %q is not of the form key=value", pair)
+		}
+		key, value := strings.TrimSpace(pair[:ind]), strings.TrimSpace(pair[ind+1:])
+
+		switch key {
+		case "verify":
+			if err := parseBool(&params.verify, key, value); err != nil {
+				return nil, err
+			}
+		case "fail_on_loss":
+			if err := parseBool(&params.failOnLoss, key, value); err != nil {
+				return nil, err
+			}
+		case "check":
+			if err := parseBool(&params.check, key, value); err != nil {
+				return nil, err
+			}
+		case "suffix":
+			if len(value) == 0 || strings.Contains(value, "/") {
+				return nil, fmt.Errorf("suffix must be a file extension, not %q", value)
+			}
+			params.suffix = value
+		case "mirror":
+			var mirror bool
+			if err := parseBool(&mirror, key, value); err != nil {
+				return nil, err
+			}
+			if !mirror {
+				params.mirrorRoot = ""
+			} else if len(params.mirrorRoot) == 0 {
+				params.mirrorRoot = defaultMirrorRoot
+			}
+		case "proto_path":
+			for _, root := range filepath.SplitList(value) {
+				if len(root) > 0 {
+					params.protoPaths = append(params.protoPaths, root)
+				}
+			}
+		case "mirror_root":
+			root := path.Clean(value)
+			if len(value) == 0 || path.IsAbs(root) || root == "." || root == ".." || strings.HasPrefix(root, "../") {
+				return nil, fmt.Errorf("mirror_root must be a directory inside the output directory, not %q", value)
+			}
+			params.mirrorRoot = root
+		default:
+			if err := check.Set(key, value); err != nil {
+				return nil, err
+			}
+			params.style = append(params.style, setting{key, value})
+		}
+	}
+
+	return params, nil
+}
+
+func parseBool(b *bool, key, value string) error {
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("%s must be true or false, not %q", key, value)
+	}
+	*b = v
+	return nil
+}
+
+// Returns the name of the output file for the file with the given name.
+func (this *parameters) outputName(filename string) string {
+	if len(this.suffix) > 0 {
+		filename = strings.TrimSuffix(filename, ".proto") + this.suffix
+	}
+	if len(this.mirrorRoot) > 0 {
+		filename = path.Join(this.mirrorRoot, filename)
+	}
+	return filename
+}
+
+// Returns the path of the source of the file with the given proto-relative
+// name, found in the first of the proto_path roots that has it. Without roots
+// the file is looked for in the working directory.
+func (this *parameters) sourcePath(filename string) (string, bool) {
+	roots := this.protoPaths
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	for _, root := range roots {
+		p := filepath.Join(root, filepath.FromSlash(filename))
+		if info, err := os.Stat(p); err == nil && info.Mode().IsRegular() {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// Returns the style for the file with the given name: the style of its
+// configuration files, overridden by the parameters.
+func (this *parameters) styleFor(filename string) (*descriptor.Style, error) {
+	if p, ok := this.sourcePath(filename); ok {
+		filename = p
+	}
+	style, err := config.ForFile(filename, descriptor.DefaultStyle())
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range this.style {
+		if err := style.Set(s.key, s.value); err != nil {
+			return nil, err
+		}
+	}
+	return style, nil
+}
@@ -0,0 +1,203 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package parser
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A Header is the comments at the top of a .proto file, before its first
+// line of code.
+type Header struct {
+	// The comments as written, ending in a blank line
+	Text string
+	// Number of lines of the source the header takes up
+	Lines int
+	// Set if the last comment of the header is directly above the code, so
+	// that protoc attached it to the first element of the file
+	Attached bool
+}
+
+// ParseHeader finds the header of the given source. A run of // comments
+// directly above the code documents the first element and is not part of the
+// header, a /* */ block is.
+func ParseHeader(content string) Header {
+	lines := strings.Split(content, "\n")
+
+	// The line after the last comment of the header, and after the last
+	// comment of any kind
+	headerEnd, commentEnd := 0, 0
+	// The line the current run of // comments started at
+	runStart := -1
+
+	i := 0
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if len(line) == 0 {
+			if runStart >= 0 {
+				headerEnd = commentEnd
+				runStart = -1
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, "//") {
+			if runStart < 0 {
+				runStart = i
+			}
+			commentEnd = i + 1
+			continue
+		}
+
+		if strings.HasPrefix(line, "/*") {
+			end, ok := blockEnd(lines, i)
+			if !ok {
+				break
+			}
+			runStart = -1
+			i = end
+			headerEnd, commentEnd = end+1, end+1
+			continue
+		}
+
+		// Code
+		break
+	}
+
+	// A run of // comments that reaches the end of the file is a header too
+	if runStart >= 0 && i == len(lines) {
+		headerEnd = commentEnd
+	}
+	if headerEnd == 0 {
+		return Header{}
+	}
+
+	var s []string
+	blank := false
+	for _, line := range lines[:headerEnd] {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case len(trimmed) == 0:
+			blank = true
+			continue
+		case strings.HasPrefix(trimmed, "//"):
+			line = trimmed
+		default:
+			line = strings.TrimRight(line, " \t\r")
+		}
+		if blank && len(s) > 0 {
+			s = append(s, "")
+		}
+		blank = false
+		s = append(s, line)
+	}
+
+	return Header{
+		Text:     strings.Join(s, "\n") + "\n\n",
+		Lines:    headerEnd,
+		Attached: headerEnd == i && i < len(lines),
+	}
+}
+
+// Returns the line the block comment starting on the given line ends on, and
+// whether the block is the last thing on that line.
+func blockEnd(lines []string, start int) (int, bool) {
+	rest := lines[start][strings.Index(lines[start], "/*")+2:]
+	for j := start; j < len(lines); j++ {
+		if j > start {
+			rest = lines[j]
+		}
+		if k := strings.Index(rest, "*/"); k >= 0 {
+			return j, len(strings.TrimSpace(rest[k+2:])) == 0
+		}
+	}
+	return len(lines), false
+}
+
+// A HeaderTemplate is the header every file should start with. The text
+// {{year}} in it stands for any year, and is replaced by the current one when
+// the header is inserted.
+type HeaderTemplate struct {
+	text    string
+	pattern *regexp.Regexp
+}
+
+const yearPlaceholder = "{{year}}"
+
+// NewHeaderTemplate makes a template of the given comments.
+func NewHeaderTemplate(text string) (*HeaderTemplate, error) {
+	header := ParseHeader(text)
+	if header.Lines == 0 || len(strings.TrimSpace(strings.Join(strings.Split(text, "\n")[header.Lines:], "\n"))) > 0 {
+		return nil, fmt.Errorf("a header template must consist of comments only")
+	}
+
+	parts := strings.Split(header.Text, yearPlaceholder)
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	pattern, err := regexp.Compile("^" + strings.Join(parts, "[0-9]{4}") + "$")
+	if err != nil {
+		return nil, err
+	}
+	return &HeaderTemplate{header.Text, pattern}, nil
+}
+
+// ReadHeaderTemplate reads the template from the given file.
+func ReadHeaderTemplate(filename string) (*HeaderTemplate, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	template, err := NewHeaderTemplate(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return template, nil
+}
+
+// Matches returns whether the header is the template, with any year.
+func (this *HeaderTemplate) Matches(header string) bool {
+	return this.pattern.MatchString(header)
+}
+
+// Render returns the header of the template for the given year.
+func (this *HeaderTemplate) Render(year int) string {
+	return strings.Replace(this.text, yearPlaceholder, strconv.Itoa(year), -1)
+}
+
+// Apply returns the header a file with the given header should have. Files
+// without a header get the template, and if enforce is set, so do files with a
+// different header.
+func (this *HeaderTemplate) Apply(header string, enforce bool, year int) string {
+	if len(header) == 0 || (enforce && !this.Matches(header)) {
+		return this.Render(year)
+	}
+	return header
+}
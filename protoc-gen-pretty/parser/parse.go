@@ -29,7 +29,11 @@
 package parser
 
 import (
+	"errors"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 )
 import "github.com/DirkBrand/protobuf-code-formatter/protoc-gen-pretty/descriptor"
@@ -44,11 +48,24 @@ func (this *errCmd) Error() string {
 	return this.err.Error() + ":" + string(this.output)
 }
 
+// ParseFile parses the file with the given name, and the files it imports, as
+// they are found in the given paths.  The well-known types are found after all
+// the paths, so that they can be imported without giving the include
+// directory of protoc, and a path that has its own copies of them wins.
 func ParseFile(filename string, paths ...string) (*descriptor.FileDescriptorSet, error) {
 	return parseFile(filename, true, true, paths...)
 }
 
 func parseFile(filename string, includeSourceInfo bool, includeImports bool, paths ...string) (*descriptor.FileDescriptorSet, error) {
+	wellKnown, err := wellKnownImports(filename, paths)
+	if err != nil {
+		return nil, err
+	}
+	if len(wellKnown) > 0 {
+		defer os.RemoveAll(wellKnown)
+		paths = append(append([]string{}, paths...), wellKnown)
+	}
+
 	args := []string{"--proto_path=" + strings.Join(paths, ":")}
 	if includeSourceInfo {
 		args = append(args, "--include_source_info")
@@ -69,3 +86,70 @@ func parseFile(filename string, includeSourceInfo bool, includeImports bool, pat
 	}
 	return fileDesc, nil
 }
+
+// Validate checks that the given content of the file with the given name
+// parses, with the other files as the only imports it can see. The files are
+// written to a private temporary directory, so that nothing in the working
+// directory is touched or read.
+func Validate(filename string, content string, files []*descriptor.FileDescriptorProto) error {
+	_, err := Reparse(filename, content, files)
+	return err
+}
+
+// Reparse parses the given content of the file with the given name like
+// Validate, and returns its descriptor, without source info.
+func Reparse(filename string, content string, files []*descriptor.FileDescriptorProto) (*descriptor.FileDescriptorProto, error) {
+	dir, err := ioutil.TempDir("", "protoc-gen-pretty")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	imports := &descriptor.FileDescriptorSet{}
+	for _, file := range files {
+		if file.GetName() != filename {
+			imports.File = append(imports.File, file)
+		}
+	}
+	data, err := proto.Marshal(imports)
+	if err != nil {
+		return nil, err
+	}
+	importsFile := filepath.Join(dir, "imports.pb")
+	if err := ioutil.WriteFile(importsFile, data, 0600); err != nil {
+		return nil, err
+	}
+
+	srcDir := filepath.Join(dir, "src")
+	srcFile := filepath.Join(srcDir, filepath.FromSlash(filename))
+	if err := os.MkdirAll(filepath.Dir(srcFile), 0700); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(srcFile, []byte(content), 0600); err != nil {
+		return nil, err
+	}
+
+	outFile := filepath.Join(dir, "out.pb")
+	args := []string{"--proto_path=" + srcDir, "--descriptor_set_in=" + importsFile, "--descriptor_set_out=" + outFile, srcFile}
+	cmd := exec.Command("protoc", args...)
+	if data, err := cmd.CombinedOutput(); err != nil {
+		// Report the errors against the name of the file, not the copy
+		data = []byte(strings.Replace(string(data), srcDir+string(filepath.Separator), "", -1))
+		return nil, &errCmd{data, err}
+	}
+
+	data, err = ioutil.ReadFile(outFile)
+	if err != nil {
+		return nil, err
+	}
+	out := &descriptor.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, out); err != nil {
+		return nil, err
+	}
+	for _, file := range out.File {
+		if file.GetName() == filepath.ToSlash(filename) {
+			return file, nil
+		}
+	}
+	return nil, errors.New(filename + ": missing from the output of protoc")
+}
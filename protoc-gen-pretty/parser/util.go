@@ -8,46 +8,14 @@ import (
 	"strings"
 )
 
+// ReadFileHeader returns the header of the file with the given name, see
+// ParseHeader.
 func ReadFileHeader(filename string) string {
-	var s string
-
-	f, err := os.Open(filename)
+	content, err := ioutil.ReadFile(filename)
 	if err != nil {
 		panic(err)
 	}
-	defer f.Close()
-	r := bufio.NewReader(f)
-	gap := 0
-	for {
-		path, err := r.ReadString(10) // 0x0A separator = newline
-		if err == io.EOF {
-			// do something here
-			break
-		} else if err != nil {
-			panic(err)
-		}
-
-		path = strings.TrimSpace(path)
-
-		if strings.HasPrefix(path, "//") {
-			gap = 0
-			s += path + "\n"
-		} else if len(path) == 0 {
-			if gap == 0 {
-				s += "\n"
-			}
-			gap += 1
-		} else {
-			if gap == 0 {
-				s = ""
-				break
-			} else {
-				break
-			}
-		}
-	}
-
-	return s
+	return ParseHeader(string(content)).Text
 }
 
 func Strcmp(a, b string) int {
@@ -159,7 +127,14 @@ func FixFloatingComments(filename string) {
 		file = append(file, path)
 	}
 
+	// The header is printed as it is written
+	header := ParseHeader(strings.Join(file, ""))
+
 	for i, line := range file {
+		if i < header.Lines {
+			continue
+		}
+
 		// Start line comment
 		if strings.HasPrefix(strings.TrimSpace(line), "//") {
 			if (i > 0 && len(strings.TrimSpace(file[i-1])) == 0) || i == 0 {
@@ -0,0 +1,108 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package parser
+
+import (
+	"embed"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+)
+
+// The well-known types that protoc comes with, such as
+// google/protobuf/timestamp.proto, and descriptor.proto itself.
+//
+//go:embed wellknown
+var wellKnownTypes embed.FS
+
+// Import statements at the start of a line or after another statement on it.
+var importStatement = regexp.MustCompile(`(?m)(?:^|;)\s*import\s+(?:public\s+|weak\s+)?["']([^"']+)["']`)
+
+// wellKnownImports writes the well-known types that the file imports, itself
+// or through the files it imports, and that none of the paths has, to a new
+// temporary directory, and returns the directory.  It returns "" if nothing
+// is missing.  Only the missing files are written, as protoc should not see
+// two copies of a file that one of the paths has already.
+func wellKnownImports(filename string, paths []string) (string, error) {
+	var missing []string
+	seen := make(map[string]bool)
+	var visit func(src []byte)
+	visit = func(src []byte) {
+		for _, match := range importStatement.FindAllSubmatch(src, -1) {
+			name := string(match[1])
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			if src, ok := findImport(name, paths); ok {
+				visit(src)
+			} else if src, err := wellKnownTypes.ReadFile(path.Join("wellknown", name)); err == nil {
+				missing = append(missing, name)
+				visit(src)
+			}
+		}
+	}
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		// protoc reports it
+		return "", nil
+	}
+	visit(src)
+	if len(missing) == 0 {
+		return "", nil
+	}
+
+	dir, err := ioutil.TempDir("", "protoc-gen-pretty")
+	if err != nil {
+		return "", err
+	}
+	for _, name := range missing {
+		src, _ := wellKnownTypes.ReadFile(path.Join("wellknown", name))
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+		if err := ioutil.WriteFile(file, src, 0600); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// Returns the contents of the file with the given name in the first of the
+// paths that has it.
+func findImport(name string, paths []string) ([]byte, bool) {
+	for _, root := range paths {
+		if src, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(name))); err == nil {
+			return src, true
+		}
+	}
+	return nil, false
+}
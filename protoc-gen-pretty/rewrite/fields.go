@@ -0,0 +1,276 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+package rewrite
+
+import (
+	proto "code.google.com/p/gogoprotobuf/proto"
+	"fmt"
+	descriptor "github.com/DirkBrand/protobuf-code-formatter/protoc-gen-pretty/descriptor"
+	"strconv"
+	"strings"
+)
+
+// Changes the fields of the file that match the pattern of the rule, in all
+// messages and extends. Groups are left alone.
+func rewriteFields(set *descriptor.FileDescriptorSet, file *descriptor.FileDescriptorProto, rule *Rule) (int, error) {
+	from := strings.Fields(rule.Pattern)
+	to := strings.Fields(rule.Replacement)
+
+	toType, toTypeName, ok := resolveType(set, file, to[0])
+	if !ok {
+		return 0, fmt.Errorf("rewrite rule %v: unknown type %s", rule, to[0])
+	}
+	fromType, fromTypeName, ok := resolveType(set, file, from[0])
+	if !ok {
+		// Nothing can be of a type that does not exist
+		return 0, nil
+	}
+
+	var matches []*descriptor.FieldDescriptorProto
+	match := func(fields []*descriptor.FieldDescriptorProto) {
+		for _, field := range fields {
+			if field.GetType() == descriptor.FieldDescriptorProto_TYPE_GROUP {
+				continue
+			}
+			if field.GetType() != fromType || field.GetTypeName() != fromTypeName {
+				continue
+			}
+			if from[1] != "*" && field.GetName() != from[1] {
+				continue
+			}
+			matches = append(matches, field)
+		}
+	}
+
+	var walk func(messages []*descriptor.DescriptorProto)
+	walk = func(messages []*descriptor.DescriptorProto) {
+		for _, message := range messages {
+			match(message.Field)
+			match(message.Extension)
+			walk(message.NestedType)
+		}
+	}
+	walk(file.MessageType)
+	match(file.Extension)
+
+	// The file is left alone unless every field can be changed
+	if toType != fromType || toTypeName != fromTypeName {
+		for _, field := range matches {
+			if err := checkRetype(set, field, toType, toTypeName); err != nil {
+				return 0, fmt.Errorf("rewrite rule %v: %v", rule, err)
+			}
+		}
+	}
+
+	for _, field := range matches {
+		t := toType
+		field.Type = &t
+		field.TypeName = nil
+		if len(toTypeName) > 0 {
+			field.TypeName = proto.String(toTypeName)
+		}
+		if to[1] != "*" && to[1] != field.GetName() {
+			descriptor.RenameField(field, to[1])
+		}
+	}
+	return len(matches), nil
+}
+
+// Returns why the field cannot be given the type, if its default value or
+// one of its built-in options is not valid for it.
+func checkRetype(set *descriptor.FileDescriptorSet, field *descriptor.FieldDescriptorProto, t descriptor.FieldDescriptorProto_Type, typeName string) error {
+	if field.DefaultValue != nil && !validDefault(set, field.GetDefaultValue(), t, typeName) {
+		return fmt.Errorf("the default %q of field %s is not a valid %s", field.GetDefaultValue(), field.GetName(), typeString(t, typeName))
+	}
+
+	options := field.GetOptions()
+	if options == nil {
+		return nil
+	}
+	invalid := ""
+	switch {
+	case options.Packed != nil && !packable(t):
+		invalid = "packed"
+	case options.Lazy != nil && t != descriptor.FieldDescriptorProto_TYPE_MESSAGE:
+		invalid = "lazy"
+	case options.Jstype != nil && !is64Bit(t):
+		invalid = "jstype"
+	case options.Ctype != nil && t != descriptor.FieldDescriptorProto_TYPE_STRING && t != descriptor.FieldDescriptorProto_TYPE_BYTES:
+		invalid = "ctype"
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("option %s of field %s is not allowed on a %s", invalid, field.GetName(), typeString(t, typeName))
+	}
+	return nil
+}
+
+// Returns whether the default value, as it is stored in a descriptor, is a
+// valid default for a field of the type.
+func validDefault(set *descriptor.FileDescriptorSet, value string, t descriptor.FieldDescriptorProto_Type, typeName string) bool {
+	var err error
+	switch t {
+	case descriptor.FieldDescriptorProto_TYPE_INT32, descriptor.FieldDescriptorProto_TYPE_SINT32, descriptor.FieldDescriptorProto_TYPE_SFIXED32:
+		_, err = strconv.ParseInt(value, 10, 32)
+	case descriptor.FieldDescriptorProto_TYPE_INT64, descriptor.FieldDescriptorProto_TYPE_SINT64, descriptor.FieldDescriptorProto_TYPE_SFIXED64:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case descriptor.FieldDescriptorProto_TYPE_UINT32, descriptor.FieldDescriptorProto_TYPE_FIXED32:
+		_, err = strconv.ParseUint(value, 10, 32)
+	case descriptor.FieldDescriptorProto_TYPE_UINT64, descriptor.FieldDescriptorProto_TYPE_FIXED64:
+		_, err = strconv.ParseUint(value, 10, 64)
+	case descriptor.FieldDescriptorProto_TYPE_FLOAT, descriptor.FieldDescriptorProto_TYPE_DOUBLE:
+		switch value {
+		case "inf", "-inf", "nan":
+		default:
+			_, err = strconv.ParseFloat(value, 64)
+		}
+	case descriptor.FieldDescriptorProto_TYPE_BOOL:
+		return value == "true" || value == "false"
+	case descriptor.FieldDescriptorProto_TYPE_STRING, descriptor.FieldDescriptorProto_TYPE_BYTES:
+	case descriptor.FieldDescriptorProto_TYPE_ENUM:
+		enum := findEnum(set, strings.TrimPrefix(typeName, "."))
+		if enum == nil {
+			return false
+		}
+		for _, v := range enum.GetValue() {
+			if v.GetName() == value {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+	return err == nil
+}
+
+// Returns whether repeated fields of the type can be packed.
+func packable(t descriptor.FieldDescriptorProto_Type) bool {
+	switch t {
+	case descriptor.FieldDescriptorProto_TYPE_STRING, descriptor.FieldDescriptorProto_TYPE_BYTES, descriptor.FieldDescriptorProto_TYPE_MESSAGE, descriptor.FieldDescriptorProto_TYPE_GROUP:
+		return false
+	}
+	return true
+}
+
+func is64Bit(t descriptor.FieldDescriptorProto_Type) bool {
+	switch t {
+	case descriptor.FieldDescriptorProto_TYPE_INT64, descriptor.FieldDescriptorProto_TYPE_UINT64, descriptor.FieldDescriptorProto_TYPE_SINT64, descriptor.FieldDescriptorProto_TYPE_FIXED64, descriptor.FieldDescriptorProto_TYPE_SFIXED64:
+		return true
+	}
+	return false
+}
+
+// Returns the type as it is written in a rule.
+func typeString(t descriptor.FieldDescriptorProto_Type, typeName string) string {
+	if len(typeName) > 0 {
+		return strings.TrimPrefix(typeName, ".")
+	}
+	return strings.ToLower(strings.TrimPrefix(t.String(), "TYPE_"))
+}
+
+// Returns the type of a field of the type with the given name, and its
+// fully-qualified type name for messages and enums. Names that are not
+// qualified are looked up in the package of the file.
+func resolveType(set *descriptor.FileDescriptorSet, file *descriptor.FileDescriptorProto, name string) (descriptor.FieldDescriptorProto_Type, string, bool) {
+	if t, ok := descriptor.FieldDescriptorProto_Type_value["TYPE_"+strings.ToUpper(name)]; ok && name == strings.ToLower(name) {
+		switch descriptor.FieldDescriptorProto_Type(t) {
+		case descriptor.FieldDescriptorProto_TYPE_GROUP, descriptor.FieldDescriptorProto_TYPE_MESSAGE, descriptor.FieldDescriptorProto_TYPE_ENUM:
+		default:
+			return descriptor.FieldDescriptorProto_Type(t), "", true
+		}
+	}
+
+	names := []string{strings.TrimPrefix(name, ".")}
+	if !strings.HasPrefix(name, ".") && len(file.GetPackage()) > 0 {
+		names = append([]string{file.GetPackage() + "." + name}, names...)
+	}
+	for _, fullName := range names {
+		for _, f := range set.GetFile() {
+			if t, ok := findType(f, fullName); ok {
+				return t, "." + fullName, true
+			}
+		}
+	}
+	return 0, "", false
+}
+
+// Returns whether the file defines a message or an enum with the given
+// fully-qualified name, and which of the two it is.
+func findType(file *descriptor.FileDescriptorProto, fullName string) (descriptor.FieldDescriptorProto_Type, bool) {
+	prefix := ""
+	if len(file.GetPackage()) > 0 {
+		prefix = file.GetPackage() + "."
+	}
+
+	var find func(prefix string, messages []*descriptor.DescriptorProto, enums []*descriptor.EnumDescriptorProto) (descriptor.FieldDescriptorProto_Type, bool)
+	find = func(prefix string, messages []*descriptor.DescriptorProto, enums []*descriptor.EnumDescriptorProto) (descriptor.FieldDescriptorProto_Type, bool) {
+		for _, enum := range enums {
+			if prefix+enum.GetName() == fullName {
+				return descriptor.FieldDescriptorProto_TYPE_ENUM, true
+			}
+		}
+		for _, message := range messages {
+			if prefix+message.GetName() == fullName {
+				return descriptor.FieldDescriptorProto_TYPE_MESSAGE, true
+			}
+			if strings.HasPrefix(fullName, prefix+message.GetName()+".") {
+				return find(prefix+message.GetName()+".", message.NestedType, message.EnumType)
+			}
+		}
+		return 0, false
+	}
+	return find(prefix, file.MessageType, file.EnumType)
+}
+
+// Returns the enum with the given fully-qualified name from the set, or nil.
+func findEnum(set *descriptor.FileDescriptorSet, fullName string) *descriptor.EnumDescriptorProto {
+	var find func(prefix string, messages []*descriptor.DescriptorProto, enums []*descriptor.EnumDescriptorProto) *descriptor.EnumDescriptorProto
+	find = func(prefix string, messages []*descriptor.DescriptorProto, enums []*descriptor.EnumDescriptorProto) *descriptor.EnumDescriptorProto {
+		for _, enum := range enums {
+			if prefix+enum.GetName() == fullName {
+				return enum
+			}
+		}
+		for _, message := range messages {
+			if strings.HasPrefix(fullName, prefix+message.GetName()+".") {
+				if enum := find(prefix+message.GetName()+".", message.NestedType, message.EnumType); enum != nil {
+					return enum
+				}
+			}
+		}
+		return nil
+	}
+	for _, file := range set.GetFile() {
+		prefix := ""
+		if len(file.GetPackage()) > 0 {
+			prefix = file.GetPackage() + "."
+		}
+		if enum := find(prefix, file.MessageType, file.EnumType); enum != nil {
+			return enum
+		}
+	}
+	return nil
+}
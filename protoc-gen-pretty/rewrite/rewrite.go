@@ -0,0 +1,144 @@
+/*
+
+Copyright (c) 2013, Dirk Brand
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification, are permitted
+provided that the following conditions are met:
+
+ * Redistributions of source code must retain the above copyright notice, this list of
+   conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of
+   conditions and the following disclaimer in the documentation and/or other materials provided
+   with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE AUTHOR AND CONTRIBUTORS ``AS IS'' AND ANY EXPRESS OR IMPLIED
+WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND
+FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE AUTHOR OR CONTRIBUTORS
+BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA,
+OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT
+OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+*/
+
+// Package rewrite applies rewrite rules, like those of gofmt -r, to the
+// descriptor of a .proto file before it is formatted.
+//
+// A rule is written "pattern -> replacement" and is one of:
+//
+//	(old.opt) -> (new.opt)            renames a custom option
+//	"old.proto" -> "new.proto"        replaces an import
+//	int32 user_id -> int64 user_id    changes the type or name of fields
+//
+// In a field rule the type is a scalar type or the name of a message or enum,
+// and a name of * stands for the name of any field.
+package rewrite
+
+import (
+	"fmt"
+	descriptor "github.com/DirkBrand/protobuf-code-formatter/protoc-gen-pretty/descriptor"
+	"strings"
+)
+
+const (
+	optionRule = iota
+	importRule
+	fieldRule
+)
+
+// Rule is a single rewrite rule.
+type Rule struct {
+	Pattern     string
+	Replacement string
+
+	kind int
+}
+
+// Parse parses a rule of the form "pattern -> replacement".
+func Parse(rule string) (*Rule, error) {
+	parts := strings.Split(rule, "->")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("rewrite rule %q must be of the form 'pattern -> replacement'", rule)
+	}
+	this := &Rule{Pattern: strings.TrimSpace(parts[0]), Replacement: strings.TrimSpace(parts[1])}
+
+	switch {
+	case isOptionName(this.Pattern) && isOptionName(this.Replacement):
+		this.kind = optionRule
+	case isQuoted(this.Pattern) && isQuoted(this.Replacement):
+		this.kind = importRule
+	case len(strings.Fields(this.Pattern)) == 2 && len(strings.Fields(this.Replacement)) == 2:
+		this.kind = fieldRule
+		if strings.Fields(this.Pattern)[1] != "*" && strings.Fields(this.Replacement)[1] == "*" {
+			return nil, fmt.Errorf("rewrite rule %q: the replacement can only keep the name of the fields if the pattern matches any name", rule)
+		}
+	default:
+		return nil, fmt.Errorf("rewrite rule %q: the pattern and replacement must both be options, imports or fields", rule)
+	}
+	return this, nil
+}
+
+func (this *Rule) String() string {
+	return this.Pattern + " -> " + this.Replacement
+}
+
+func isOptionName(s string) bool {
+	return len(s) > 2 && strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")")
+}
+
+func isQuoted(s string) bool {
+	return len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`)
+}
+
+// Apply applies the rules to the file with the given name in the set, and
+// returns the number of changes they made to it. Options are renamed when the
+// file is printed, so those renames are not counted. The set must be the one
+// that is formatted afterwards.
+func Apply(set *descriptor.FileDescriptorSet, fileName string, rules []*Rule) (int, error) {
+	var file *descriptor.FileDescriptorProto
+	for _, f := range set.GetFile() {
+		if f.GetName() == fileName {
+			file = f
+		}
+	}
+	if file == nil {
+		return 0, fmt.Errorf("%s: not found", fileName)
+	}
+
+	changes := 0
+	renames := make(map[string]string)
+	for _, rule := range rules {
+		switch rule.kind {
+		case optionRule:
+			renames[optionName(rule.Pattern)] = optionName(rule.Replacement)
+		case importRule:
+			changes += rewriteImports(file, strings.Trim(rule.Pattern, `"`), strings.Trim(rule.Replacement, `"`))
+		case fieldRule:
+			n, err := rewriteFields(set, file, rule)
+			if err != nil {
+				return changes, err
+			}
+			changes += n
+		}
+	}
+	descriptor.RenameOptions(renames)
+	return changes, nil
+}
+
+// Returns the fully-qualified name of an option as it is written in a rule.
+func optionName(s string) string {
+	return strings.TrimPrefix(strings.Trim(s, "()"), ".")
+}
+
+func rewriteImports(file *descriptor.FileDescriptorProto, from, to string) int {
+	changes := 0
+	for i, dependency := range file.Dependency {
+		if dependency == from {
+			file.Dependency[i] = to
+			changes += 1
+		}
+	}
+	return changes
+}
@@ -29,15 +29,50 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	config "github.com/DirkBrand/protobuf-code-formatter/protoc-gen-pretty/config"
+	descriptor "github.com/DirkBrand/protobuf-code-formatter/protoc-gen-pretty/descriptor"
 	parser "github.com/DirkBrand/protobuf-code-formatter/protoc-gen-pretty/parser"
+	rewrite "github.com/DirkBrand/protobuf-code-formatter/protoc-gen-pretty/rewrite"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 var recurs *bool
 var imp_path *string
 var excluded []string
+var style = descriptor.DefaultStyle()
+var styleFlags = make(map[string]bool)
+var headerTemplate *parser.HeaderTemplate
+var enforceHeader *bool
+var rules rewriteRules
+var diffOnly *bool
+
+// Where progress and errors are written. With -d only the diffs go to stdout.
+var messages = os.Stdout
+
+// rewriteRules collects the -rewrite flags.
+type rewriteRules []*rewrite.Rule
+
+func (this *rewriteRules) String() string {
+	var s []string
+	for _, rule := range *this {
+		s = append(s, rule.String())
+	}
+	return strings.Join(s, ", ")
+}
+
+func (this *rewriteRules) Set(value string) error {
+	rule, err := rewrite.Parse(value)
+	if err != nil {
+		return err
+	}
+	*this = append(*this, rule)
+	return nil
+}
 
 func main() {
 
@@ -45,13 +80,37 @@ func main() {
 	recurs = flag.Bool("r", false, "Indicates whether to recursively format the files in the argument folder.")
 	imp_path = flag.String("proto_path", "./", "The path to find all relative imported .proto files.")
 	exclude_dirs := flag.String("exclude_path", "None", "A list of directories that should not be included in the formatting (if done recursively)")
+	flag.BoolVar(&style.QualifiedTypeNames, "qualified_types", false, "Indicates whether to print type references by their fully-qualified names.")
+	flag.BoolVar(&style.Sort, "sort", false, "Indicates whether to sort declarations by name, and fields and enum values by number.")
+	flag.BoolVar(&style.Simplify, "s", false, "Indicates whether to leave out defaults and options that are set to the value they have anyway.")
+	header_template := flag.String("header_template", "", "A file with the header comments to insert in files without a header. {{year}} stands for the current year.")
+	enforceHeader = flag.Bool("enforce_header", false, "Indicates whether to replace headers that differ from the header template.")
+	flag.Var(&rules, "rewrite", "A rewrite rule of the form 'pattern -> replacement', applied before formatting. Can be given more than once.")
+	diffOnly = flag.Bool("d", false, "Indicates whether to print the changes as diffs instead of writing the files.")
 
 	flag.Parse()
+	flag.Visit(func(f *flag.Flag) {
+		styleFlags[f.Name] = true
+	})
+	if *diffOnly {
+		messages = os.Stderr
+	}
 
 	excluded = strings.Split(*exclude_dirs, ":")
 
+	if len(*header_template) > 0 {
+		var err error
+		if headerTemplate, err = parser.ReadHeaderTemplate(*header_template); err != nil {
+			fmt.Fprintln(messages, err)
+			os.Exit(1)
+		}
+	} else if *enforceHeader {
+		fmt.Fprintln(messages, errors.New("-enforce_header needs a -header_template"))
+		os.Exit(1)
+	}
+
 	if len(os.Args) <= 1 || strings.HasPrefix(os.Args[len(os.Args)-1], "-") {
-		fmt.Println(errors.New("Not enough arguments!"))
+		fmt.Fprintln(messages, errors.New("Not enough arguments!"))
 		os.Exit(1)
 	}
 
@@ -60,8 +119,8 @@ func main() {
 	// Visit the directory / .proto file
 	err := filepath.Walk(proto_path, fmtFn())
 	if err != nil {
-		fmt.Println(err)
-	} else {
+		fmt.Fprintln(messages, err)
+	} else if !*diffOnly {
 		fmt.Println("DONE")
 	}
 
@@ -85,18 +144,87 @@ func fmtFn() filepath.WalkFunc {
 				return filepath.SkipDir
 			}
 		} else if f.Mode().IsRegular() && strings.HasSuffix(f.Name(), ".proto") {
-			parser.FixFloatingComments(pathThusFar)
+			original, err := ioutil.ReadFile(pathThusFar)
+			if err != nil {
+				return err
+			}
+
+			// Without writing, the comments are fixed up in a copy of the file
+			source := pathThusFar
+			if *diffOnly {
+				dir, err := ioutil.TempDir("", "protofmt")
+				if err != nil {
+					return err
+				}
+				defer os.RemoveAll(dir)
+				source = filepath.Join(dir, f.Name())
+				if err := ioutil.WriteFile(source, original, 0600); err != nil {
+					return err
+				}
+			}
 
-			d, err := parser.ParseFile(pathThusFar, filepath.Dir(pathThusFar), *imp_path)
+			parser.FixFloatingComments(source)
+			var header parser.Header
+			if src, err := ioutil.ReadFile(source); err == nil {
+				descriptor.RegisterSource(f.Name(), src)
+				header = parser.ParseHeader(string(src))
+			}
+
+			d, err := parser.ParseFile(source, filepath.Dir(source), filepath.Dir(pathThusFar), *imp_path)
 			if err != nil {
-				fmt.Println("Parsing error in " + pathThusFar + "!")
+				fmt.Fprintln(messages, "Parsing error in "+pathThusFar+"!")
 				return err
 			} else {
-				header := parser.ReadFileHeader(pathThusFar)
-				formattedFile := d.Fmt(f.Name())
+				fileStyle, err := config.ForFile(pathThusFar, descriptor.DefaultStyle())
+				if err != nil {
+					return err
+				}
+				// Flags on the command-line win over the configuration files
+				if styleFlags["qualified_types"] {
+					fileStyle.QualifiedTypeNames = style.QualifiedTypeNames
+				}
+				if styleFlags["sort"] {
+					fileStyle.Sort = style.Sort
+				}
+				if styleFlags["s"] {
+					fileStyle.Simplify = style.Simplify
+				}
+
+				if _, err := rewrite.Apply(d, f.Name(), rules); err != nil {
+					return err
+				}
+
+				if header.Attached {
+					d.DetachHeader(f.Name())
+				}
+				formattedFile := d.FmtStyle(f.Name(), fileStyle)
+				for _, w := range descriptor.Warnings() {
+					fmt.Fprintln(os.Stderr, "Warning: "+w.String())
+				}
 				formattedFile = strings.TrimSpace(formattedFile)
-				if len(header) != 0 {
-					formattedFile = header + "\n" + formattedFile
+
+				headerText := header.Text
+				if headerTemplate != nil {
+					headerText = headerTemplate.Apply(headerText, *enforceHeader, time.Now().Year())
+				}
+				if len(headerText) != 0 {
+					formattedFile = headerText + formattedFile
+				}
+
+				if len(rules) > 0 {
+					if _, err := parser.Reparse(f.Name(), formattedFile, d.GetFile()); err != nil {
+						return fmt.Errorf("%s: the rewritten file does not parse: %v", f.Name(), err)
+					}
+				}
+				if fileStyle.Simplify {
+					if err := checkSimplified(d, f.Name(), formattedFile); err != nil {
+						fmt.Fprintln(messages, "Not simplifying "+pathThusFar+"!")
+						return err
+					}
+				}
+
+				if *diffOnly {
+					return printDiff(pathThusFar, original, []byte(formattedFile))
 				}
 
 				fo, _ := os.Create(pathThusFar)
@@ -114,6 +242,55 @@ func fmtFn() filepath.WalkFunc {
 
 }
 
+// Checks that the simplified file still defines what the original does, so
+// that nothing is written otherwise.
+func checkSimplified(d *descriptor.FileDescriptorSet, name string, formatted string) error {
+	var original *descriptor.FileDescriptorProto
+	for _, file := range d.GetFile() {
+		if file.GetName() == name {
+			original = file
+		}
+	}
+	reparsed, err := parser.Reparse(name, formatted, d.GetFile())
+	if err != nil {
+		return err
+	}
+	if !descriptor.Equivalent(original, reparsed) {
+		return errors.New(name + ": the simplified file defines different things")
+	}
+	return nil
+}
+
+// Prints the changes formatting made to the file as a unified diff.
+func printDiff(filename string, original []byte, formatted []byte) error {
+	if string(original) == string(formatted) {
+		return nil
+	}
+
+	dir, err := ioutil.TempDir("", "protofmt")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	before := filepath.Join(dir, "before.proto")
+	after := filepath.Join(dir, "after.proto")
+	if err := ioutil.WriteFile(before, original, 0600); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(after, formatted, 0600); err != nil {
+		return err
+	}
+
+	// diff exits with 1 when the files differ
+	data, err := exec.Command("diff", "-u", "--label", filename, "--label", "protofmt/"+filename, before, after).Output()
+	if len(data) == 0 && err != nil {
+		return err
+	}
+	fmt.Printf("diff %s protofmt/%s\n", filename, filename)
+	os.Stdout.Write(data)
+	return nil
+}
+
 func stringInSlice(a string, list []string) bool {
 	for _, b := range list {
 		if strings.HasPrefix(a, b) {